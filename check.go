@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/huderlem/poryscript-pls/config"
+	"github.com/huderlem/poryscript-pls/lsp"
+	"github.com/huderlem/poryscript-pls/server"
+)
+
+// Exit codes for the check command.
+const (
+	checkExitOk     = 0
+	checkExitErrors = 1
+	checkExitFailed = 2
+)
+
+// Runs the headless 'check' command, which prints the diagnostics for
+// every Poryscript file in a directory. Returns the process exit code.
+func runCheck(args []string) int {
+	flags := flag.NewFlagSet("check", flag.ExitOnError)
+	formatPtr := flags.String("format", "text", "output format: text, json, or sarif")
+	settingsPtr := flags.String("settings", "", "JSON file with the Poryscript settings (e.g. commandIncludes)")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: poryscript-pls check [flags] [dir]\n\nChecks every .pory file in dir (default: current directory).\n\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() > 1 {
+		flags.Usage()
+		return checkExitFailed
+	}
+	dir := "."
+	if flags.NArg() == 1 {
+		dir = flags.Arg(0)
+	}
+
+	settings := config.New().DefaultSettings
+	if len(*settingsPtr) > 0 {
+		var err error
+		if settings, err = config.LoadSettingsFile(*settingsPtr); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return checkExitFailed
+		}
+	}
+
+	results, err := server.Check(context.Background(), dir, settings)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return checkExitFailed
+	}
+	switch *formatPtr {
+	case "text":
+		err = writeCheckText(os.Stdout, results)
+	case "json":
+		err = writeCheckJSON(os.Stdout, results)
+	case "sarif":
+		err = writeCheckSARIF(os.Stdout, results)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown output format '%s'\n", *formatPtr)
+		return checkExitFailed
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return checkExitFailed
+	}
+
+	for _, result := range results {
+		for _, d := range result.Diagnostics {
+			if d.Severity == lsp.Error {
+				return checkExitErrors
+			}
+		}
+	}
+	return checkExitOk
+}
+
+// Gets the display name of a diagnostic severity.
+func getSeverityName(severity lsp.DiagnosticSeverity) string {
+	switch severity {
+	case lsp.Error:
+		return "error"
+	case lsp.Warning:
+		return "warning"
+	case lsp.Information:
+		return "info"
+	default:
+		return "hint"
+	}
+}
+
+// Writes the diagnostics in a compiler-like format, one per line.
+func writeCheckText(w io.Writer, results []server.CheckResult) error {
+	for _, result := range results {
+		for _, d := range result.Diagnostics {
+			line := fmt.Sprintf("%s:%d:%d: %s: %s", filepath.ToSlash(result.Path), d.Range.Start.Line+1, d.Range.Start.Character+1, getSeverityName(d.Severity), d.Message)
+			if len(d.Code) > 0 {
+				line += fmt.Sprintf(" [%s]", d.Code)
+			}
+			if _, err := fmt.Fprintln(w, line); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+type checkJSONDiagnostic struct {
+	File      string `json:"file"`
+	Line      int    `json:"line"`
+	Column    int    `json:"column"`
+	EndLine   int    `json:"endLine"`
+	EndColumn int    `json:"endColumn"`
+	Severity  string `json:"severity"`
+	Code      string `json:"code,omitempty"`
+	Message   string `json:"message"`
+}
+
+// Writes the diagnostics as a JSON array. Lines and columns are 1-based.
+func writeCheckJSON(w io.Writer, results []server.CheckResult) error {
+	diagnostics := []checkJSONDiagnostic{}
+	for _, result := range results {
+		for _, d := range result.Diagnostics {
+			diagnostics = append(diagnostics, checkJSONDiagnostic{
+				File:      filepath.ToSlash(result.Path),
+				Line:      d.Range.Start.Line + 1,
+				Column:    d.Range.Start.Character + 1,
+				EndLine:   d.Range.End.Line + 1,
+				EndColumn: d.Range.End.Character + 1,
+				Severity:  getSeverityName(d.Severity),
+				Code:      d.Code,
+				Message:   d.Message,
+			})
+		}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(diagnostics)
+}
+
+// Writes the diagnostics as a SARIF 2.1.0 log, which code scanning
+// tools, such as GitHub's, can display.
+// https://docs.oasis-open.org/sarif/sarif/v2.1.0/sarif-v2.1.0.html
+func writeCheckSARIF(w io.Writer, results []server.CheckResult) error {
+	type sarifRegion struct {
+		StartLine   int `json:"startLine"`
+		StartColumn int `json:"startColumn"`
+		EndLine     int `json:"endLine"`
+		EndColumn   int `json:"endColumn"`
+	}
+	type sarifArtifactLocation struct {
+		URI string `json:"uri"`
+	}
+	type sarifPhysicalLocation struct {
+		ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+		Region           sarifRegion           `json:"region"`
+	}
+	type sarifLocation struct {
+		PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+	}
+	type sarifMessage struct {
+		Text string `json:"text"`
+	}
+	type sarifResult struct {
+		RuleID    string          `json:"ruleId"`
+		Level     string          `json:"level"`
+		Message   sarifMessage    `json:"message"`
+		Locations []sarifLocation `json:"locations"`
+	}
+	type sarifDriver struct {
+		Name           string `json:"name"`
+		Version        string `json:"version"`
+		InformationURI string `json:"informationUri"`
+	}
+	type sarifTool struct {
+		Driver sarifDriver `json:"driver"`
+	}
+	type sarifRun struct {
+		Tool    sarifTool     `json:"tool"`
+		Results []sarifResult `json:"results"`
+	}
+	type sarifLog struct {
+		Schema  string     `json:"$schema"`
+		Version string     `json:"version"`
+		Runs    []sarifRun `json:"runs"`
+	}
+
+	sarifResults := []sarifResult{}
+	for _, result := range results {
+		for _, d := range result.Diagnostics {
+			ruleID := d.Code
+			if len(ruleID) == 0 {
+				ruleID = "poryscript"
+			}
+			level := "note"
+			if d.Severity == lsp.Error || d.Severity == lsp.Warning {
+				level = getSeverityName(d.Severity)
+			}
+			sarifResults = append(sarifResults, sarifResult{
+				RuleID:  ruleID,
+				Level:   level,
+				Message: sarifMessage{Text: d.Message},
+				Locations: []sarifLocation{{
+					PhysicalLocation: sarifPhysicalLocation{
+						ArtifactLocation: sarifArtifactLocation{URI: filepath.ToSlash(result.Path)},
+						Region: sarifRegion{
+							StartLine:   d.Range.Start.Line + 1,
+							StartColumn: d.Range.Start.Character + 1,
+							EndLine:     d.Range.End.Line + 1,
+							EndColumn:   d.Range.End.Character + 1,
+						},
+					},
+				}},
+			})
+		}
+	}
+	log := sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs: []sarifRun{{
+			Tool: sarifTool{Driver: sarifDriver{
+				Name:           "poryscript-pls",
+				Version:        version,
+				InformationURI: "https://github.com/huderlem/poryscript-pls",
+			}},
+			Results: sarifResults,
+		}},
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(log)
+}
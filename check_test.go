@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/huderlem/poryscript-pls/config"
+	"github.com/huderlem/poryscript-pls/server"
+)
+
+// Writes a small project to a temporary directory, and returns the settings
+// for checking it.
+func writeCheckFixture(t *testing.T) (string, config.PoryscriptSettings) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"include/constants/flags.h": "#define FLAG_FOO 0x1\n",
+		"include/constants/vars.h":  "#define VAR_FOO 0x4000\n",
+		"data/scripts/clean.pory":   "script Clean {\n}\n",
+		"data/scripts/wrong.pory": `script Wrong {
+	if (flag(VAR_FOO)) {
+	}
+	if (flag(FLAG_MISSING)) {
+	}
+}
+`,
+	}
+	for path, content := range files {
+		path = filepath.Join(dir, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	settings := config.New().DefaultSettings
+	settings.CommandConfigFilepath = ""
+	settings.FontConfigFilepath = ""
+	settings.SymbolIncludes = []config.TokenIncludeSetting{
+		{Expression: `^\s*#define\s+(FLAG_\w+)\s+(.+)`, Type: "define", File: "include/constants/flags.h"},
+		{Expression: `^\s*#define\s+(VAR_\w+)\s+(.+)`, Type: "define", File: "include/constants/vars.h"},
+	}
+	return dir, settings
+}
+
+func TestCheckWriters(t *testing.T) {
+	tests := []struct {
+		format   string
+		write    func(io.Writer, []server.CheckResult) error
+		expected string
+	}{
+		{
+			format: "text",
+			write:  writeCheckText,
+			expected: `data/scripts/wrong.pory:2:11: warning: VAR_FOO is a var, but a flag is expected [warning-wrongFlagOrVar]
+data/scripts/wrong.pory:4:11: warning: Unknown flag "FLAG_MISSING" [warning-unknownFlagOrVar]
+`,
+		},
+		{
+			format: "json",
+			write:  writeCheckJSON,
+			expected: `[
+  {
+    "file": "data/scripts/wrong.pory",
+    "line": 2,
+    "column": 11,
+    "endLine": 2,
+    "endColumn": 18,
+    "severity": "warning",
+    "code": "warning-wrongFlagOrVar",
+    "message": "VAR_FOO is a var, but a flag is expected"
+  },
+  {
+    "file": "data/scripts/wrong.pory",
+    "line": 4,
+    "column": 11,
+    "endLine": 4,
+    "endColumn": 23,
+    "severity": "warning",
+    "code": "warning-unknownFlagOrVar",
+    "message": "Unknown flag \"FLAG_MISSING\""
+  }
+]
+`,
+		},
+		{
+			format: "sarif",
+			write:  writeCheckSARIF,
+			expected: `{
+  "$schema": "https://json.schemastore.org/sarif-2.1.0.json",
+  "version": "2.1.0",
+  "runs": [
+    {
+      "tool": {
+        "driver": {
+          "name": "poryscript-pls",
+          "version": "` + version + `",
+          "informationUri": "https://github.com/huderlem/poryscript-pls"
+        }
+      },
+      "results": [
+        {
+          "ruleId": "warning-wrongFlagOrVar",
+          "level": "warning",
+          "message": {
+            "text": "VAR_FOO is a var, but a flag is expected"
+          },
+          "locations": [
+            {
+              "physicalLocation": {
+                "artifactLocation": {
+                  "uri": "data/scripts/wrong.pory"
+                },
+                "region": {
+                  "startLine": 2,
+                  "startColumn": 11,
+                  "endLine": 2,
+                  "endColumn": 18
+                }
+              }
+            }
+          ]
+        },
+        {
+          "ruleId": "warning-unknownFlagOrVar",
+          "level": "warning",
+          "message": {
+            "text": "Unknown flag \"FLAG_MISSING\""
+          },
+          "locations": [
+            {
+              "physicalLocation": {
+                "artifactLocation": {
+                  "uri": "data/scripts/wrong.pory"
+                },
+                "region": {
+                  "startLine": 4,
+                  "startColumn": 11,
+                  "endLine": 4,
+                  "endColumn": 23
+                }
+              }
+            }
+          ]
+        }
+      ]
+    }
+  ]
+}
+`,
+		},
+	}
+
+	dir, settings := writeCheckFixture(t)
+	for _, tt := range tests {
+		results, err := server.Check(context.Background(), dir, settings)
+		if err != nil {
+			t.Fatalf("Test Case %s: Check failed: %s", tt.format, err)
+		}
+		var output bytes.Buffer
+		if err := tt.write(&output, results); err != nil {
+			t.Fatalf("Test Case %s: Writing failed: %s", tt.format, err)
+		}
+		if output.String() != tt.expected {
+			t.Errorf("Test Case %s: Expected:\n%s\n\nGot:\n%s", tt.format, tt.expected, output.String())
+		}
+	}
+}
@@ -2,7 +2,9 @@ package config
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"os"
 	"sync"
 
 	"github.com/huderlem/poryscript-pls/lsp"
@@ -13,10 +15,16 @@ var lock = sync.Mutex{}
 
 // Configuration for the Poryscript language server.
 type Config struct {
-	FileSettings                       map[string]PoryscriptSettings
-	HasConfigCapability                bool
-	HasWorkspaceFolderCapability       bool
-	HasDiagnosticRelatedInfoCapability bool
+	FileSettings                            map[string]PoryscriptSettings
+	DefaultSettings                         PoryscriptSettings
+	HasConfigCapability                     bool
+	HasWorkspaceFolderCapability            bool
+	HasDiagnosticRelatedInfoCapability      bool
+	HasHierarchicalDocumentSymbolCapability bool
+	HasSnippetCapability                    bool
+	// The maximum number of folding ranges that the client wants per
+	// document, or 0 if there is no limit.
+	FoldingRangeLimit int
 }
 
 // Settings for the Poryscript language server. These are controlled
@@ -30,32 +38,104 @@ type PoryscriptSettings struct {
 	CommandConfigFilepath string `json:"commandConfigFilepath"`
 	// Filepath for font width config JSON file (used for line-length validation).
 	FontConfigFilepath string `json:"fontConfigFilepath"`
+	// Whether or not to clear a file's diagnostics when it is closed.
+	ClearDiagnosticsOnClose bool `json:"clearDiagnosticsOnClose"`
+	// Whether or not to warn about symbols that are never referenced.
+	ReportUnusedSymbols bool `json:"reportUnusedSymbols"`
+	// Glob patterns for symbol names that are never reported as unused,
+	// such as scripts that are only referenced by map JSON files or
+	// assembly files.
+	UnusedSymbolAllowlist []string `json:"unusedSymbolAllowlist"`
 }
 
 type TokenIncludeSetting struct {
 	Expression string `json:"expression"`
-	Type       string `json:"type"`
-	File       string `json:"file"`
+	// The type of the included tokens, such as "special" or "define".
+	// Defines can also use the "flag", "var", "trainer", or "item" type, so
+	// that they are validated and completed in the right places even if they
+	// don't follow the usual naming conventions.
+	Type string `json:"type"`
+	File string `json:"file"`
 }
 
+// The command include files that define the decomp's standard scripting commands.
+var defaultCommandIncludes = []string{"asm/macros/event.inc", "asm/macros/movement.inc"}
+
 var defaultPoryscriptSettings = PoryscriptSettings{
-	CommandIncludes:       []string{"asm/macros/event.inc", "asm/macros/movement.inc"},
+	CommandIncludes:       defaultCommandIncludes,
 	SymbolIncludes:        []TokenIncludeSetting{},
 	CommandConfigFilepath: "tools/poryscript/command_config.json",
 	FontConfigFilepath:    "tools/poryscript/font_config.json",
 }
 
+// Options for the Poryscript language server that are sent by the client
+// in the 'initialize' request.
+type InitializationOptions struct {
+	// Read workspace files with the custom requests that the Poryscript
+	// VS Code extension provides, rather than reading them from disk.
+	UseClientFileSystem bool `json:"useClientFileSystem"`
+}
+
+// ParseInitializationOptions reads the InitializationOptions from the raw
+// options in the 'initialize' request. Unknown or malformed options are
+// ignored.
+func ParseInitializationOptions(options interface{}) InitializationOptions {
+	result := InitializationOptions{}
+	if options == nil {
+		return result
+	}
+	data, err := json.Marshal(options)
+	if err != nil {
+		return result
+	}
+	json.Unmarshal(data, &result)
+	return result
+}
+
 func New() Config {
 	return Config{
-		FileSettings:                       map[string]PoryscriptSettings{},
-		HasConfigCapability:                false,
-		HasWorkspaceFolderCapability:       false,
-		HasDiagnosticRelatedInfoCapability: false,
+		FileSettings:                            map[string]PoryscriptSettings{},
+		DefaultSettings:                         defaultPoryscriptSettings,
+		HasConfigCapability:                     false,
+		HasWorkspaceFolderCapability:            false,
+		HasDiagnosticRelatedInfoCapability:      false,
+		HasHierarchicalDocumentSymbolCapability: false,
+		HasSnippetCapability:                    false,
+	}
+}
+
+// LoadSettingsFile reads PoryscriptSettings from the given JSON file. Any
+// settings that are missing from the file keep their default values.
+func LoadSettingsFile(filepath string) (PoryscriptSettings, error) {
+	settings := defaultPoryscriptSettings
+	// Unmarshalling reuses a slice's backing array, so the defaults are
+	// copied to keep them from being overwritten.
+	settings.CommandIncludes = append([]string{}, defaultCommandIncludes...)
+	content, err := os.ReadFile(filepath)
+	if err != nil {
+		return PoryscriptSettings{}, err
+	}
+	if err := json.Unmarshal(content, &settings); err != nil {
+		return PoryscriptSettings{}, fmt.Errorf("failed to parse settings file '%s': %s", filepath, err)
 	}
+	return settings, nil
+}
+
+// Returns true if the given command include file is one of the default
+// includes, which define the decomp's standard scripting commands.
+func IsDefaultCommandInclude(include string) bool {
+	for _, defaultInclude := range defaultCommandIncludes {
+		if include == defaultInclude {
+			return true
+		}
+	}
+	return false
 }
 
 // Completely clears the cached settings.
 func (c *Config) ClearSettings() {
+	lock.Lock()
+	defer lock.Unlock()
 	c.FileSettings = map[string]PoryscriptSettings{}
 }
 
@@ -64,18 +144,22 @@ func (c *Config) ClearSettings() {
 // Settings are cached on a filepath-by-filepath basis..
 func (c *Config) GetFileSettings(ctx context.Context, conn jsonrpc2.JSONRPC2, filepath string) (PoryscriptSettings, error) {
 	if !c.HasConfigCapability {
-		return defaultPoryscriptSettings, nil
+		return c.DefaultSettings, nil
 	}
 	lock.Lock()
-	defer lock.Unlock()
-	if settings, ok := c.FileSettings[filepath]; ok {
+	settings, ok := c.FileSettings[filepath]
+	lock.Unlock()
+	if ok {
 		return settings, nil
 	}
+	// The lock isn't held while waiting on the client.
 	settings, err := c.fetchFileSettings(ctx, conn, filepath)
 	if err != nil {
 		return PoryscriptSettings{}, err
 	}
+	lock.Lock()
 	c.FileSettings[filepath] = settings
+	lock.Unlock()
 	return settings, nil
 }
 
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/huderlem/poryscript-pls/lsp"
+	"github.com/huderlem/poryscript-pls/parse"
+)
+
+// Exit codes for the format command.
+const (
+	formatExitOk          = 0
+	formatExitUnformatted = 1
+	formatExitFailed      = 2
+)
+
+// Runs the headless 'format' command, which formats Poryscript files in the
+// same way as the language server's formatting request. Returns the process
+// exit code.
+func runFormat(args []string) int {
+	flags := flag.NewFlagSet("format", flag.ExitOnError)
+	writePtr := flags.Bool("w", false, "write the formatted content back to the files, instead of printing it")
+	listPtr := flags.Bool("l", false, "list the files whose formatting differs, instead of printing them")
+	tabSizePtr := flags.Int("tabsize", 4, "indentation width, when indenting with spaces")
+	spacesPtr := flags.Bool("spaces", false, "indent with spaces instead of tabs")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: poryscript-pls format [flags] path...\n\nFormats the given .pory files, and every .pory file in the given directories.\nWith -l, exits with status 1 if any file isn't formatted, unless -w is also\ngiven to format them.\n\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return formatExitFailed
+	}
+
+	paths, err := getFormatPaths(flags.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return formatExitFailed
+	}
+	options := lsp.FormattingOptions{TabSize: *tabSizePtr, InsertSpaces: *spacesPtr}
+	exitCode := formatExitOk
+	for _, path := range paths {
+		bytes, err := os.ReadFile(path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return formatExitFailed
+		}
+		content := string(bytes)
+		formatted := parse.Format(content, options)
+		if !*listPtr && !*writePtr {
+			fmt.Print(formatted)
+			continue
+		}
+		if formatted == content {
+			continue
+		}
+		if *listPtr {
+			fmt.Println(filepath.ToSlash(path))
+		}
+		if *writePtr {
+			if err := os.WriteFile(path, []byte(formatted), 0644); err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				return formatExitFailed
+			}
+		} else {
+			exitCode = formatExitUnformatted
+		}
+	}
+	return exitCode
+}
+
+// Gets the Poryscript files to format from the command's arguments.
+// Directories are searched for .pory files, skipping hidden directories.
+func getFormatPaths(args []string) ([]string, error) {
+	paths := []string{}
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			paths = append(paths, arg)
+			continue
+		}
+		dirPaths := []string{}
+		err = filepath.WalkDir(arg, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if entry.IsDir() {
+				if path != arg && strings.HasPrefix(entry.Name(), ".") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if strings.HasSuffix(entry.Name(), ".pory") {
+				dirPaths = append(dirPaths, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(dirPaths)
+		paths = append(paths, dirPaths...)
+	}
+	return paths, nil
+}
@@ -1,18 +1,80 @@
 package lsp
 
+// SemanticTokenType is the index of a token type in the legend returned by
+// NewSemanticTokensLegend.
+type SemanticTokenType int
+
+const (
+	STTKeyword SemanticTokenType = iota
+	STTFunction
+	STTEnumMember
+	STTVariable
+	STTMacro
+	STTLabel
+	STTString
+	STTParameter
+	STTNumber
+)
+
+var semanticTokenTypeNames = []string{
+	STTKeyword:    "keyword",
+	STTFunction:   "function",
+	STTEnumMember: "enumMember",
+	STTVariable:   "variable",
+	STTMacro:      "macro",
+	STTLabel:      "label",
+	STTString:     "string",
+	STTParameter:  "parameter",
+	STTNumber:     "number",
+}
+
+func (t SemanticTokenType) String() string {
+	if t < 0 || int(t) >= len(semanticTokenTypeNames) {
+		return ""
+	}
+	return semanticTokenTypeNames[t]
+}
+
+// SemanticTokenModifiers is a set of token modifiers, where each modifier
+// is the bit at its index in the legend returned by NewSemanticTokensLegend.
+type SemanticTokenModifiers int
+
+const (
+	STMDeclaration SemanticTokenModifiers = 1 << iota
+	STMReadonly
+	STMDefaultLibrary
+	STMDeprecated
+)
+
+var semanticTokenModifierNames = []string{
+	"declaration",
+	"readonly",
+	"defaultLibrary",
+	"deprecated",
+}
+
+// Creates the legend that describes the token types and modifiers used by
+// SemanticTokenBuilder.
+func NewSemanticTokensLegend() SemanticTokensLegend {
+	return SemanticTokensLegend{
+		TokenTypes:     append([]string{}, semanticTokenTypeNames...),
+		TokenModifiers: append([]string{}, semanticTokenModifierNames...),
+	}
+}
+
 type SemanticToken struct {
 	line           int
 	startChar      int
 	length         int
-	tokenType      int
-	tokenModifiers int
+	tokenType      SemanticTokenType
+	tokenModifiers SemanticTokenModifiers
 }
 
 type SemanticTokenBuilder struct {
 	tokens []SemanticToken
 }
 
-func (b *SemanticTokenBuilder) AddToken(line, startChar, length, tokenType, tokenModifiers int) {
+func (b *SemanticTokenBuilder) AddToken(line, startChar, length int, tokenType SemanticTokenType, tokenModifiers SemanticTokenModifiers) {
 	b.tokens = append(b.tokens, SemanticToken{
 		line:           line,
 		startChar:      startChar,
@@ -23,22 +85,43 @@ func (b *SemanticTokenBuilder) AddToken(line, startChar, length, tokenType, toke
 }
 
 func (b *SemanticTokenBuilder) Build() []uint {
+	return encodeTokens(b.tokens)
+}
+
+// Builds the encoded data for the tokens that start inside of the given
+// range, for a 'textDocument/semanticTokens/range' request.
+func (b *SemanticTokenBuilder) BuildRange(r Range) []uint {
+	tokens := []SemanticToken{}
+	for _, token := range b.tokens {
+		start := Position{Line: token.line, Character: token.startChar}
+		if !isPositionBefore(start, r.Start) && isPositionBefore(start, r.End) {
+			tokens = append(tokens, token)
+		}
+	}
+	return encodeTokens(tokens)
+}
+
+func isPositionBefore(a Position, b Position) bool {
+	return a.Line < b.Line || (a.Line == b.Line && a.Character < b.Character)
+}
+
+func encodeTokens(tokens []SemanticToken) []uint {
 	data := []uint{}
-	for i := range b.tokens {
-		encoded := b.encodeTokenAt(i)
+	for i := range tokens {
+		encoded := encodeTokenAt(tokens, i)
 		data = append(data, encoded...)
 	}
 	return data
 }
 
-func (b *SemanticTokenBuilder) encodeTokenAt(index int) []uint {
-	token := b.tokens[index]
+func encodeTokenAt(tokens []SemanticToken, index int) []uint {
+	token := tokens[index]
 	encoded := make([]uint, 5)
 
 	prevLine := 0
 	prevStartChar := 0
 	if index > 0 {
-		prevToken := b.tokens[index-1]
+		prevToken := tokens[index-1]
 		prevLine = prevToken.line
 		if token.line == prevLine {
 			prevStartChar = prevToken.startChar
@@ -55,3 +138,26 @@ func (b *SemanticTokenBuilder) encodeTokenAt(index int) []uint {
 
 	return encoded
 }
+
+// Computes the edits that turn the previous encoded token data into the
+// current data, for a 'textDocument/semanticTokens/full/delta' request.
+// The result is a single edit that replaces everything between the data's
+// common prefix and suffix, or no edits if the data is unchanged.
+func DiffSemanticTokens(previous []uint, current []uint) []SemanticTokensEdit {
+	prefix := 0
+	for prefix < len(previous) && prefix < len(current) && previous[prefix] == current[prefix] {
+		prefix++
+	}
+	if prefix == len(previous) && prefix == len(current) {
+		return []SemanticTokensEdit{}
+	}
+	suffix := 0
+	for suffix < len(previous)-prefix && suffix < len(current)-prefix && previous[len(previous)-1-suffix] == current[len(current)-1-suffix] {
+		suffix++
+	}
+	return []SemanticTokensEdit{{
+		Start:       uint(prefix),
+		DeleteCount: uint(len(previous) - prefix - suffix),
+		Data:        current[prefix : len(current)-suffix],
+	}}
+}
@@ -0,0 +1,104 @@
+package lsp
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSemanticTokenBuilder_BuildRange(t *testing.T) {
+	b := SemanticTokenBuilder{}
+	b.AddToken(0, 2, 4, 1, 0)
+	b.AddToken(2, 0, 3, 2, 0)
+	b.AddToken(2, 5, 6, 3, 0)
+	b.AddToken(4, 1, 2, 0, 0)
+
+	tests := []struct {
+		r    Range
+		want []uint
+	}{
+		{
+			r:    Range{Start: Position{Line: 0, Character: 0}, End: Position{Line: 10, Character: 0}},
+			want: b.Build(),
+		},
+		{
+			r:    Range{Start: Position{Line: 1, Character: 0}, End: Position{Line: 3, Character: 0}},
+			want: []uint{2, 0, 3, 2, 0, 0, 5, 6, 3, 0},
+		},
+		{
+			r:    Range{Start: Position{Line: 2, Character: 3}, End: Position{Line: 4, Character: 1}},
+			want: []uint{2, 5, 6, 3, 0},
+		},
+		{
+			r:    Range{Start: Position{Line: 5, Character: 0}, End: Position{Line: 6, Character: 0}},
+			want: []uint{},
+		},
+	}
+	for _, tt := range tests {
+		if got := b.BuildRange(tt.r); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("BuildRange(%v) = %v, want %v", tt.r, got, tt.want)
+		}
+	}
+}
+
+func TestDiffSemanticTokens(t *testing.T) {
+	tests := []struct {
+		previous []uint
+		current  []uint
+		want     []SemanticTokensEdit
+	}{
+		{
+			previous: []uint{0, 1, 2, 0, 0},
+			current:  []uint{0, 1, 2, 0, 0},
+			want:     []SemanticTokensEdit{},
+		},
+		{
+			previous: []uint{0, 1, 2, 0, 0, 1, 0, 3, 1, 0},
+			current:  []uint{0, 1, 2, 0, 0, 2, 0, 3, 1, 0},
+			want:     []SemanticTokensEdit{{Start: 5, DeleteCount: 1, Data: []uint{2}}},
+		},
+		{
+			previous: []uint{0, 1, 2, 0, 0},
+			current:  []uint{0, 1, 2, 0, 0, 1, 0, 3, 1, 0},
+			want:     []SemanticTokensEdit{{Start: 5, DeleteCount: 0, Data: []uint{1, 0, 3, 1, 0}}},
+		},
+		{
+			previous: []uint{0, 1, 2, 0, 0, 1, 0, 3, 1, 0},
+			current:  []uint{1, 0, 3, 1, 0},
+			want:     []SemanticTokensEdit{{Start: 0, DeleteCount: 5, Data: []uint{}}},
+		},
+		{
+			previous: []uint{},
+			current:  []uint{0, 1, 2, 0, 0},
+			want:     []SemanticTokensEdit{{Start: 0, DeleteCount: 0, Data: []uint{0, 1, 2, 0, 0}}},
+		},
+	}
+	for _, tt := range tests {
+		if got := DiffSemanticTokens(tt.previous, tt.current); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("DiffSemanticTokens(%v, %v) = %v, want %v", tt.previous, tt.current, got, tt.want)
+		}
+	}
+}
+
+func TestNewSemanticTokensLegend(t *testing.T) {
+	legend := NewSemanticTokensLegend()
+	for _, tt := range []SemanticTokenType{STTKeyword, STTMacro, STTNumber} {
+		if got := legend.TokenTypes[tt]; got != tt.String() {
+			t.Errorf("TokenTypes[%d] = %s, want %s", tt, got, tt.String())
+		}
+	}
+	modifiers := map[SemanticTokenModifiers]string{
+		STMDeclaration:    "declaration",
+		STMReadonly:       "readonly",
+		STMDefaultLibrary: "defaultLibrary",
+		STMDeprecated:     "deprecated",
+	}
+	for modifier, want := range modifiers {
+		index := 0
+		for 1<<index != int(modifier) {
+			index++
+		}
+		if got := legend.TokenModifiers[index]; got != want {
+			t.Errorf("TokenModifiers[%d] = %s, want %s", index, got, want)
+		}
+	}
+}
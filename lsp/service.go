@@ -23,6 +23,7 @@ type InitializeParams struct {
 	Trace                 Trace              `json:"trace,omitempty"`
 	InitializationOptions interface{}        `json:"initializationOptions,omitempty"`
 	Capabilities          ClientCapabilities `json:"capabilities"`
+	WorkspaceFolders      []WorkspaceFolder  `json:"workspaceFolders,omitempty"`
 
 	WorkDoneToken string `json:"workDoneToken,omitempty"`
 }
@@ -54,8 +55,18 @@ type DefinitionParams struct {
 	lspext.PartialResultParams
 }
 
+type HoverParams struct {
+	TextDocumentPositionParams
+	WorkDoneProgressParams
+}
+
 type DocumentURI string
 
+type WorkspaceFolder struct {
+	URI  DocumentURI `json:"uri"`
+	Name string      `json:"name"`
+}
+
 type ClientInfo struct {
 	Name    string `json:"name,omitempty"`
 	Version string `json:"version,omitempty"`
@@ -137,6 +148,10 @@ type TextDocumentClientCapabilities struct {
 		WillSaveWaitUntil bool `json:"willSaveWaitUntil,omitempty"`
 	} `json:"synchronization,omitempty"`
 
+	PublishDiagnostics struct {
+		RelatedInformation bool `json:"relatedInformation,omitempty"`
+	} `json:"publishDiagnostics,omitempty"`
+
 	DocumentSymbol struct {
 		SymbolKind struct {
 			ValueSet []int `json:"valueSet,omitempty"`
@@ -330,7 +345,8 @@ type ServerCapabilities struct {
 	DocumentFormattingProvider       bool                             `json:"documentFormattingProvider,omitempty"`
 	DocumentRangeFormattingProvider  bool                             `json:"documentRangeFormattingProvider,omitempty"`
 	DocumentOnTypeFormattingProvider *DocumentOnTypeFormattingOptions `json:"documentOnTypeFormattingProvider,omitempty"`
-	RenameProvider                   bool                             `json:"renameProvider,omitempty"`
+	FoldingRangeProvider             bool                             `json:"foldingRangeProvider,omitempty"`
+	RenameProvider                   *RenameOptions                   `json:"renameProvider,omitempty"`
 	ExecuteCommandProvider           *ExecuteCommandOptions           `json:"executeCommandProvider,omitempty"`
 	SemanticHighlighting             *SemanticHighlightingOptions     `json:"semanticHighlighting,omitempty"`
 	SemanticTokensProvider           *SemanticTokensOptions           `json:"semanticTokensProvider,omitempty"`
@@ -466,6 +482,33 @@ type SemanticTokens struct {
 	Data     []uint `json:"data"`
 }
 
+type SemanticTokensRangeParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+	Range        Range                  `json:"range"`
+
+	WorkDoneToken      string `json:"workDoneToken,omitempty"`
+	PartialResultToken string `json:"partialResultToken,omitempty"`
+}
+
+type SemanticTokensDeltaParams struct {
+	TextDocument     TextDocumentIdentifier `json:"textDocument"`
+	PreviousResultID string                 `json:"previousResultId"`
+
+	WorkDoneToken      string `json:"workDoneToken,omitempty"`
+	PartialResultToken string `json:"partialResultToken,omitempty"`
+}
+
+type SemanticTokensEdit struct {
+	Start       uint   `json:"start"`
+	DeleteCount uint   `json:"deleteCount"`
+	Data        []uint `json:"data,omitempty"`
+}
+
+type SemanticTokensDelta struct {
+	ResultID string               `json:"resultId,omitempty"`
+	Edits    []SemanticTokensEdit `json:"edits"`
+}
+
 type CompletionItemKind int
 
 const (
@@ -697,6 +740,26 @@ type DocumentSymbolParams struct {
 	TextDocument TextDocumentIdentifier `json:"textDocument"`
 }
 
+type FoldingRangeParams struct {
+	TextDocument TextDocumentIdentifier `json:"textDocument"`
+}
+
+type FoldingRangeKind string
+
+const (
+	FRKComment FoldingRangeKind = "comment"
+	FRKImports FoldingRangeKind = "imports"
+	FRKRegion  FoldingRangeKind = "region"
+)
+
+type FoldingRange struct {
+	StartLine      int              `json:"startLine"`
+	StartCharacter *int             `json:"startCharacter,omitempty"`
+	EndLine        int              `json:"endLine"`
+	EndCharacter   *int             `json:"endCharacter,omitempty"`
+	Kind           FoldingRangeKind `json:"kind,omitempty"`
+}
+
 type SymbolKind int
 
 // The SymbolKind values are defined at https://microsoft.github.io/language-server-protocol/specification.
@@ -762,6 +825,16 @@ var symbolKindName = map[SymbolKind]string{
 	SKTypeParameter: "TypeParameter",
 }
 
+type DocumentSymbol struct {
+	Name           string           `json:"name"`
+	Detail         string           `json:"detail,omitempty"`
+	Kind           SymbolKind       `json:"kind"`
+	Deprecated     bool             `json:"deprecated,omitempty"`
+	Range          Range            `json:"range"`
+	SelectionRange Range            `json:"selectionRange"`
+	Children       []DocumentSymbol `json:"children,omitempty"`
+}
+
 type SymbolInformation struct {
 	Name          string     `json:"name"`
 	Kind          SymbolKind `json:"kind"`
@@ -832,6 +905,19 @@ type RenameParams struct {
 	NewName      string                 `json:"newName"`
 }
 
+type RenameOptions struct {
+	PrepareProvider bool `json:"prepareProvider,omitempty"`
+}
+
+type PrepareRenameParams struct {
+	TextDocumentPositionParams
+}
+
+type PrepareRenameResult struct {
+	Range       Range  `json:"range"`
+	Placeholder string `json:"placeholder"`
+}
+
 type DidOpenTextDocumentParams struct {
 	TextDocument TextDocumentItem `json:"textDocument"`
 }
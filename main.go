@@ -27,6 +27,12 @@ func parseOptions() {
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "check" {
+		os.Exit(runCheck(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "format" {
+		os.Exit(runFormat(os.Args[2:]))
+	}
 	parseOptions()
 
 	s := server.New()
@@ -62,10 +62,65 @@ func (c Command) ToCompletionItem() lsp.CompletionItem {
 	if len(c.InsertText) > 0 {
 		result.InsertText = c.InsertText
 		result.InsertTextFormat = lsp.ITFSnippet
+	} else if snippet := c.GetSnippet(); len(snippet) > 0 {
+		result.InsertText = snippet
+		result.InsertTextFormat = lsp.ITFSnippet
 	}
 	return result
 }
 
+// Gets the snippet that inserts a call to a macro Command, with a tab stop
+// for each required or default parameter. Default parameters are prefilled
+// with their default values. Returns an empty string if there are no such
+// parameters.
+func (c Command) GetSnippet() string {
+	if c.Kind != CommandScriptMacro {
+		return ""
+	}
+	placeholders := []string{}
+	for _, p := range c.Parameters {
+		var text string
+		switch p.Kind {
+		case CommandParamRequired:
+			text = p.Name
+		case CommandParamDefault:
+			text = p.Default
+		default:
+			continue
+		}
+		placeholders = append(placeholders, fmt.Sprintf("${%d:%s}", len(placeholders)+1, escapeSnippetText(text)))
+	}
+	if len(placeholders) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%s(%s)", c.Name, strings.Join(placeholders, ", "))
+}
+
+// Escapes the characters that have a special meaning in snippet placeholders.
+func escapeSnippetText(text string) string {
+	return strings.NewReplacer(`\`, `\\`, "$", `\$`, "}", `\}`).Replace(text)
+}
+
+// Returns the lsp.Hover representation of a Command.
+func (c Command) ToHover() lsp.Hover {
+	contents := []lsp.MarkedString{}
+	switch c.Kind {
+	case CommandScriptMacro:
+		contents = append(contents, lsp.MarkedString{Language: "poryscript", Value: c.GetParamsLabel()})
+	case CommandAssemblyConstant:
+		contents = append(contents, lsp.MarkedString{Language: "poryscript", Value: fmt.Sprintf("%s = %s", c.Name, c.Detail)})
+	default:
+		contents = append(contents, lsp.MarkedString{Language: "poryscript", Value: c.Name})
+		if len(c.Detail) > 0 {
+			contents = append(contents, lsp.RawMarkedString(c.Detail))
+		}
+	}
+	if len(c.Documentation) > 0 {
+		contents = append(contents, lsp.RawMarkedString(c.Documentation))
+	}
+	return lsp.Hover{Contents: contents}
+}
+
 // Gets the parameters label for signature help.
 func (c Command) GetParamsLabel() string {
 	var sb strings.Builder
@@ -91,6 +146,19 @@ func (c Command) GetParamInformation() []lsp.ParameterInformation {
 	return result
 }
 
+// Returns true if the Command is a Poryscript keyword that begins a
+// top-level statement, such as script or movement.
+func (c Command) IsTopLevelKeyword() bool {
+	return c.Kind == CommandPoryscriptKeyword && c.CompletionKind == lsp.CIKClass
+}
+
+var deprecatedRe = regexp.MustCompile(`(?i)\bdeprecated\b`)
+
+// Returns true if the Command's documentation says that it is deprecated.
+func (c Command) IsDeprecated() bool {
+	return deprecatedRe.MatchString(c.Documentation)
+}
+
 func (c Command) HasVarargParam() bool {
 	numParams := len(c.Parameters)
 	if numParams == 0 {
@@ -99,6 +167,25 @@ func (c Command) HasVarargParam() bool {
 	return c.Parameters[numParams-1].Kind == CommandParamVarArg
 }
 
+// Gets the kind of Poryscript symbol that is passed to the parameter, based
+// on the decomp's naming conventions for scripting macro parameters. Returns
+// 0 if the parameter doesn't take a symbol.
+func (c CommandParam) ExpectedSymbolKind() SymbolKind {
+	name := strings.ToLower(c.Name)
+	switch {
+	case name == "text" || strings.HasSuffix(name, "_text"):
+		return SymbolKindText
+	case name == "destination" || name == "dest" || name == "script" || strings.HasSuffix(name, "_script"):
+		return SymbolKindScript
+	case name == "movements" || name == "movement":
+		return SymbolKindMovementScript
+	case name == "products":
+		return SymbolKindMart
+	default:
+		return 0
+	}
+}
+
 func (c CommandParam) getLabelName() string {
 	switch c.Kind {
 	case CommandParamRequired:
@@ -44,6 +44,14 @@ func TestCommandToCompletionItem(t *testing.T) {
 			},
 			expected: lsp.CompletionItem{Label: "baz", Kind: lsp.CIKFunction, InsertText: "insert me", InsertTextFormat: lsp.ITFSnippet},
 		},
+		{
+			input: Command{
+				Name:       "applymovement",
+				Kind:       CommandScriptMacro,
+				Parameters: []CommandParam{{Name: "localId", Kind: CommandParamRequired}, {Name: "movements", Kind: CommandParamRequired}},
+			},
+			expected: lsp.CompletionItem{Label: "applymovement", Kind: lsp.CIKKeyword, InsertText: "applymovement(${1:localId}, ${2:movements})", InsertTextFormat: lsp.ITFSnippet},
+		},
 	}
 	for i, tt := range tests {
 		result := tt.input.ToCompletionItem()
@@ -53,6 +61,101 @@ func TestCommandToCompletionItem(t *testing.T) {
 	}
 }
 
+func TestCommandGetSnippet(t *testing.T) {
+	tests := []struct {
+		input    Command
+		expected string
+	}{
+		{
+			input:    Command{Name: "lock", Kind: CommandScriptMacro},
+			expected: "",
+		},
+		{
+			input: Command{
+				Name: "msgbox",
+				Kind: CommandScriptMacro,
+				Parameters: []CommandParam{
+					{Name: "text", Kind: CommandParamRequired},
+					{Name: "type", Kind: CommandParamDefault, Default: "MSGBOX_DEFAULT"},
+				},
+			},
+			expected: "msgbox(${1:text}, ${2:MSGBOX_DEFAULT})",
+		},
+		{
+			input: Command{
+				Name: "trainerbattle",
+				Kind: CommandScriptMacro,
+				Parameters: []CommandParam{
+					{Name: "type", Kind: CommandParamRequired},
+					{Name: "trainer", Kind: CommandParamRequired},
+					{Name: "local_id", Kind: CommandParamOptional},
+					{Name: "pointers", Kind: CommandParamVarArg},
+				},
+			},
+			expected: "trainerbattle(${1:type}, ${2:trainer})",
+		},
+		{
+			input: Command{
+				Name:       "weird",
+				Kind:       CommandScriptMacro,
+				Parameters: []CommandParam{{Name: "x", Kind: CommandParamDefault, Default: "{$1}"}},
+			},
+			expected: `weird(${1:{\$1\}})`,
+		},
+		{
+			input:    Command{Name: "MSGBOX_YESNO", Kind: CommandAssemblyConstant, Parameters: []CommandParam{{Name: "x", Kind: CommandParamRequired}}},
+			expected: "",
+		},
+	}
+	for i, tt := range tests {
+		if result := tt.input.GetSnippet(); result != tt.expected {
+			t.Errorf("Test Case %d: Expected: '%s', Got: '%s'", i, tt.expected, result)
+		}
+	}
+}
+
+func TestCommandToHover(t *testing.T) {
+	tests := []struct {
+		input    Command
+		expected lsp.Hover
+	}{
+		{
+			input: Command{
+				Name:          "msgbox",
+				Documentation: "Shows a message box.",
+				Kind:          CommandScriptMacro,
+				Parameters: []CommandParam{
+					{Name: "text", Kind: CommandParamRequired},
+					{Name: "type", Kind: CommandParamDefault, Default: "MSGBOX_DEFAULT"},
+				},
+			},
+			expected: lsp.Hover{Contents: []lsp.MarkedString{
+				{Language: "poryscript", Value: "msgbox(text, [type=MSGBOX_DEFAULT])"},
+				lsp.RawMarkedString("Shows a message box."),
+			}},
+		},
+		{
+			input: Command{Name: "MSGBOX_YESNO", Detail: "5", Kind: CommandAssemblyConstant},
+			expected: lsp.Hover{Contents: []lsp.MarkedString{
+				{Language: "poryscript", Value: "MSGBOX_YESNO = 5"},
+			}},
+		},
+		{
+			input: Command{Name: "script", Detail: "Script (Poryscript)", Kind: CommandPoryscriptKeyword},
+			expected: lsp.Hover{Contents: []lsp.MarkedString{
+				{Language: "poryscript", Value: "script"},
+				lsp.RawMarkedString("Script (Poryscript)"),
+			}},
+		},
+	}
+	for i, tt := range tests {
+		result := tt.input.ToHover()
+		if !reflect.DeepEqual(result, tt.expected) {
+			t.Errorf("Test Case %d:\nExpected:\n%v\n\nGot:\n%v", i, tt.expected, result)
+		}
+	}
+}
+
 func TestParseMacroCommands(t *testing.T) {
 	input := `
 @ Buffers the given text and calls the relevant standard message script (see gStdScripts).
@@ -328,3 +431,44 @@ create_movement_action face_up, MOVEMENT_ACTION_FACE_UP
 		}
 	}
 }
+
+func TestCommandParamExpectedSymbolKind(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected SymbolKind
+	}{
+		{name: "text", expected: SymbolKindText},
+		{name: "intro_text", expected: SymbolKindText},
+		{name: "destination", expected: SymbolKindScript},
+		{name: "dest", expected: SymbolKindScript},
+		{name: "event_script", expected: SymbolKindScript},
+		{name: "movements", expected: SymbolKindMovementScript},
+		{name: "products", expected: SymbolKindMart},
+		{name: "destIndex", expected: 0},
+		{name: "localId", expected: 0},
+		{name: "type", expected: 0},
+	}
+	for i, tt := range tests {
+		if result := (CommandParam{Name: tt.name}).ExpectedSymbolKind(); result != tt.expected {
+			t.Errorf("Test Case %d: Expected: %v, Got: %v", i, tt.expected, result)
+		}
+	}
+}
+
+func TestCommandIsDeprecated(t *testing.T) {
+	tests := []struct {
+		documentation string
+		expected      bool
+	}{
+		{documentation: "", expected: false},
+		{documentation: "Sets the specified flag.", expected: false},
+		{documentation: "Deprecated, use setflag instead.", expected: true},
+		{documentation: "This macro is DEPRECATED.", expected: true},
+		{documentation: "Clears deprecatedFlags.", expected: false},
+	}
+	for i, tt := range tests {
+		if result := (Command{Documentation: tt.documentation}).IsDeprecated(); result != tt.expected {
+			t.Errorf("Test Case %d: Expected: %v, Got: %v", i, tt.expected, result)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package parse
+
+import (
+	"github.com/huderlem/poryscript-pls/lsp"
+	"github.com/huderlem/poryscript/token"
+)
+
+// CompletionContextKind is the syntactic context of a completion request.
+type CompletionContextKind int
+
+const (
+	_ CompletionContextKind = iota
+	// Outside of any block, where only top-level statements can go.
+	CompletionContextTopLevel
+	// Inside a script or mapscripts block.
+	CompletionContextScript
+	CompletionContextMovement
+	CompletionContextMart
+	CompletionContextText
+	// Inside the parentheses of a flag(), var(), or defeated() condition.
+	CompletionContextCondition
+	// Inside the argument list of a command call.
+	CompletionContextCommandArg
+	// Inside a string or raw section, where nothing should be completed.
+	CompletionContextString
+)
+
+// CompletionContext describes where in a Poryscript file a completion was
+// requested.
+type CompletionContext struct {
+	Kind CompletionContextKind
+	// The category of define expected by a condition.
+	Category MiscTokenCategory
+	// The name of the command being called, and the index of the argument
+	// being completed.
+	Command  string
+	ArgIndex int
+}
+
+// Gets the completion context at the given position in the file content.
+// The context comes from the tokens that start before the position, so the
+// partially-typed word at the position doesn't affect it.
+func GetCompletionContext(content string, position lsp.Position) CompletionContext {
+	type openParen struct {
+		name     token.Token
+		argIndex int
+	}
+	blocks := []CompletionContextKind{}
+	parens := []openParen{}
+	pendingBlock := CompletionContextScript
+	tokens := Tokenize(content)
+	for i, t := range tokens {
+		if !isTokenStartBefore(t, position) {
+			break
+		}
+		switch t.Type {
+		case token.STRING, token.RAWSTRING:
+			if isTokenEndAfter(t, position) {
+				return CompletionContext{Kind: CompletionContextString}
+			}
+		case token.SCRIPT, token.MAPSCRIPTS:
+			pendingBlock = CompletionContextScript
+		case token.MOVEMENT:
+			pendingBlock = CompletionContextMovement
+		case token.MART:
+			pendingBlock = CompletionContextMart
+		case token.TEXT:
+			pendingBlock = CompletionContextText
+		case token.LBRACE:
+			kind := pendingBlock
+			if len(blocks) > 0 {
+				kind = blocks[len(blocks)-1]
+			}
+			blocks = append(blocks, kind)
+			parens = parens[:0]
+		case token.RBRACE:
+			if len(blocks) > 0 {
+				blocks = blocks[:len(blocks)-1]
+			}
+			parens = parens[:0]
+		case token.LPAREN:
+			p := openParen{}
+			if i > 0 {
+				p.name = tokens[i-1]
+			}
+			parens = append(parens, p)
+		case token.RPAREN:
+			if len(parens) > 0 {
+				parens = parens[:len(parens)-1]
+			}
+		case token.COMMA:
+			if len(parens) > 0 {
+				parens[len(parens)-1].argIndex++
+			}
+		}
+	}
+
+	if len(blocks) == 0 {
+		return CompletionContext{Kind: CompletionContextTopLevel}
+	}
+	context := CompletionContext{Kind: blocks[len(blocks)-1]}
+	if context.Kind != CompletionContextScript || len(parens) == 0 {
+		return context
+	}
+	// Conditions and command calls can be nested, such as 'if (flag(FLAG_X))',
+	// so the innermost call decides the context.
+	p := parens[len(parens)-1]
+	switch p.name.Type {
+	case token.FLAG:
+		context = CompletionContext{Kind: CompletionContextCondition, Category: MiscTokenCategoryFlag}
+	case token.VAR:
+		context = CompletionContext{Kind: CompletionContextCondition, Category: MiscTokenCategoryVar}
+	case token.DEFEATED:
+		context = CompletionContext{Kind: CompletionContextCondition, Category: MiscTokenCategoryTrainer}
+	case token.IDENT:
+		context = CompletionContext{Kind: CompletionContextCommandArg, Command: p.name.Literal, ArgIndex: p.argIndex}
+	}
+	return context
+}
+
+// Returns true if the token starts before the given position.
+func isTokenStartBefore(t token.Token, position lsp.Position) bool {
+	return isPositionBefore(lsp.Position{Line: t.LineNumber - 1, Character: t.StartUtf8CharIndex}, position)
+}
+
+// Returns true if the token ends after the given position.
+func isTokenEndAfter(t token.Token, position lsp.Position) bool {
+	return isPositionBefore(position, lsp.Position{Line: t.EndLineNumber - 1, Character: t.EndUtf8CharIndex})
+}
@@ -0,0 +1,89 @@
+package parse
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/huderlem/poryscript-pls/lsp"
+)
+
+func TestGetCompletionContext(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected CompletionContext
+	}{
+		{
+			input:    "|",
+			expected: CompletionContext{Kind: CompletionContextTopLevel},
+		},
+		{
+			input:    "script MyScript {\n\tlock\n}\n|",
+			expected: CompletionContext{Kind: CompletionContextTopLevel},
+		},
+		{
+			input:    "script MyScript {\n\tlo|\n}",
+			expected: CompletionContext{Kind: CompletionContextScript},
+		},
+		{
+			input:    "script MyScript {\n\tif (var(VAR_1) == 1) {\n\t\t|\n\t}\n}",
+			expected: CompletionContext{Kind: CompletionContextScript},
+		},
+		{
+			input:    "movement MyMovement {\n\twalk_left\n\t|\n}",
+			expected: CompletionContext{Kind: CompletionContextMovement},
+		},
+		{
+			input:    "mart MyMart {\n\tITEM_|\n}",
+			expected: CompletionContext{Kind: CompletionContextMart},
+		},
+		{
+			input:    "text MyText {\n\t|\n}",
+			expected: CompletionContext{Kind: CompletionContextText},
+		},
+		{
+			input:    "script MyScript {\n\tif (flag(FLA|)) {}\n}",
+			expected: CompletionContext{Kind: CompletionContextCondition, Category: MiscTokenCategoryFlag},
+		},
+		{
+			input:    "script MyScript {\n\tif (var(|",
+			expected: CompletionContext{Kind: CompletionContextCondition, Category: MiscTokenCategoryVar},
+		},
+		{
+			input:    "script MyScript {\n\tif (!defeated(|)) {}\n}",
+			expected: CompletionContext{Kind: CompletionContextCondition, Category: MiscTokenCategoryTrainer},
+		},
+		{
+			input:    "script MyScript {\n\tif (|) {}\n}",
+			expected: CompletionContext{Kind: CompletionContextScript},
+		},
+		{
+			input:    "script MyScript {\n\tgoto(|)\n}",
+			expected: CompletionContext{Kind: CompletionContextCommandArg, Command: "goto"},
+		},
+		{
+			input:    "script MyScript {\n\tgoto_if_set(FLAG_1, My|)\n}",
+			expected: CompletionContext{Kind: CompletionContextCommandArg, Command: "goto_if_set", ArgIndex: 1},
+		},
+		{
+			input:    "script MyScript {\n\tmsgbox(\"Hello |there\")\n}",
+			expected: CompletionContext{Kind: CompletionContextString},
+		},
+	}
+	for i, tt := range tests {
+		content, position := splitCursor(tt.input)
+		result := GetCompletionContext(content, position)
+		if !reflect.DeepEqual(result, tt.expected) {
+			t.Errorf("Test Case %d: Expected %+v, but got %+v", i, tt.expected, result)
+		}
+	}
+}
+
+// Removes the '|' cursor marker from the input, and returns the cursor's position.
+func splitCursor(input string) (string, lsp.Position) {
+	index := strings.Index(input, "|")
+	before := input[:index]
+	line := strings.Count(before, "\n")
+	character := len([]rune(before[strings.LastIndex(before, "\n")+1:]))
+	return before + input[index+1:], lsp.Position{Line: line, Character: character}
+}
@@ -2,6 +2,7 @@ package parse
 
 import (
 	"bufio"
+	"fmt"
 	"regexp"
 	"strings"
 
@@ -13,6 +14,9 @@ type ConstantSymbol struct {
 	Name     string
 	Position lsp.Position
 	Uri      string
+	Value    string
+	// The range of the entire declaration, through the end of its value.
+	Range lsp.Range
 }
 
 // Returns the lsp.CompletionItem representation of a ConstantSymbol.
@@ -37,6 +41,15 @@ func (c ConstantSymbol) ToLocation() lsp.Location {
 	}
 }
 
+// Returns the lsp.Hover representation of a ConstantSymbol.
+func (c ConstantSymbol) ToHover() lsp.Hover {
+	return lsp.Hover{
+		Contents: []lsp.MarkedString{
+			{Language: "poryscript", Value: fmt.Sprintf("const %s = %s", c.Name, c.Value)},
+		},
+	}
+}
+
 // Parses the Poryscript constants from the given file content.
 func ParseConstants(content string, uri string) []ConstantSymbol {
 	if len(content) == 0 {
@@ -48,15 +61,23 @@ func ParseConstants(content string, uri string) []ConstantSymbol {
 	lineNumber := 0
 	for scanner.Scan() {
 		line := stripComment(scanner.Text())
-		for _, match := range re.FindAllStringSubmatchIndex(line, -1) {
+		matches := re.FindAllStringSubmatchIndex(line, -1)
+		for i, match := range matches {
 			nameStart, nameEnd := match[2], match[3]
+			// The constant's value runs until the next constant declaration
+			// on the same line, or the end of the line.
+			valueEnd := len(line)
+			if i < len(matches)-1 {
+				valueEnd = matches[i+1][0]
+			}
 			command := ConstantSymbol{
 				Name: line[nameStart:nameEnd],
 				Position: lsp.Position{
 					Line:      lineNumber,
 					Character: match[2],
 				},
-				Uri: uri,
+				Uri:   uri,
+				Value: strings.TrimSpace(line[match[1]:valueEnd]),
 			}
 			constants = append(constants, command)
 		}
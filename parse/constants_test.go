@@ -63,6 +63,15 @@ func TestConstantToLocation(t *testing.T) {
 	}
 }
 
+func TestConstantToHover(t *testing.T) {
+	input := ConstantSymbol{Name: "FOO", Value: "54 + 3"}
+	expected := lsp.Hover{Contents: []lsp.MarkedString{{Language: "poryscript", Value: "const FOO = 54 + 3"}}}
+	result := input.ToHover()
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected:\n%v\n\nGot:\n%v", expected, result)
+	}
+}
+
 func TestParseConstants(t *testing.T) {
 	input := `
 const FOO = 54 + 3
@@ -70,9 +79,9 @@ const FOO = 54 + 3
   	const BAR = 22 const BAZ = FOO
 	# const IGNORE_ME = foo`
 	expected := []ConstantSymbol{
-		{Name: "FOO", Position: lsp.Position{Line: 1, Character: 6}, Uri: "testfile.pory"},
-		{Name: "BAR", Position: lsp.Position{Line: 3, Character: 9}, Uri: "testfile.pory"},
-		{Name: "BAZ", Position: lsp.Position{Line: 3, Character: 24}, Uri: "testfile.pory"},
+		{Name: "FOO", Position: lsp.Position{Line: 1, Character: 6}, Uri: "testfile.pory", Value: "54 + 3"},
+		{Name: "BAR", Position: lsp.Position{Line: 3, Character: 9}, Uri: "testfile.pory", Value: "22"},
+		{Name: "BAZ", Position: lsp.Position{Line: 3, Character: 24}, Uri: "testfile.pory", Value: "FOO"},
 	}
 	results := ParseConstants(input, "testfile.pory")
 	if len(expected) != len(results) {
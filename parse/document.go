@@ -7,6 +7,7 @@ import (
 	"strings"
 
 	"github.com/huderlem/poryscript-pls/lsp"
+	"github.com/huderlem/poryscript/token"
 )
 
 // Gets the full token at the given position in the content.
@@ -35,6 +36,27 @@ func GetTokenAt(content string, line int, column int) string {
 	return l[start:end]
 }
 
+// Gets the part of the token at the given position in the content that comes
+// before the position, such as the text typed so far when completing a word.
+func GetTokenPrefixAt(content string, line int, column int) string {
+	if line < 0 || column < 0 {
+		return ""
+	}
+	lines := strings.Split(content, "\n")
+	if line >= len(lines) {
+		return ""
+	}
+	l := stripComment(strings.TrimRight(lines[line], "\r"))
+	if column > len(l) {
+		return ""
+	}
+	start := getWordStart(l, column)
+	if start >= column {
+		return ""
+	}
+	return l[start:column]
+}
+
 func getWordBounds(line string, column int) (int, int) {
 	return getWordStart(line, column), getWordEnd(line, column)
 }
@@ -67,72 +89,195 @@ func getWordEnd(line string, column int) int {
 	return column
 }
 
+// CommandCallParts describes the command call that encloses a position.
 type CommandCallParts struct {
-	Command    string
-	OpenParen  lsp.Position
+	Command   string
+	OpenParen lsp.Position
+	// The position of the closing parenthesis. This is only set if the
+	// call is closed, since calls are often incomplete while typing.
 	CloseParen lsp.Position
-	Commas     []lsp.Position
+	Closed     bool
+	// The positions of the commas that separate the call's arguments.
+	// Commas inside nested calls or strings aren't included.
+	Commas []lsp.Position
 }
 
+// Gets the innermost command call whose parentheses enclose the given
+// position. The call is found from the lexer's tokens, so it can span
+// multiple lines, and parentheses and commas inside of strings are ignored.
+// Nested calls to keywords, such as format(), are skipped in favor of the
+// command that encloses them.
 func GetCommandCallParts(content string, line int, column int) (CommandCallParts, error) {
 	if line < 0 || column < 0 {
 		return CommandCallParts{}, fmt.Errorf("line and column must be >= 0. line=%d, column=%d", line, column)
 	}
-	// Scan to the targeted line.
-	curLine := 0
-	scanner := bufio.NewScanner(strings.NewReader(content))
-	l := ""
-	for scanner.Scan() {
-		l = stripComment(scanner.Text())
-		if curLine == line {
-			break
+	position := lsp.Position{Line: line, Character: column}
+	tokens := Tokenize(content)
+	openParens := []int{}
+	for i := 0; i < len(tokens) && isTokenStartBefore(tokens[i], position); i++ {
+		switch tokens[i].Type {
+		case token.LPAREN:
+			openParens = append(openParens, i)
+		case token.RPAREN:
+			if len(openParens) > 0 {
+				openParens = openParens[:len(openParens)-1]
+			}
+		case token.LBRACE, token.RBRACE:
+			// Command calls can't contain blocks, so any open call was never closed.
+			openParens = openParens[:0]
 		}
-		curLine++
 	}
-	if curLine != line || column > len(l) {
-		return CommandCallParts{}, fmt.Errorf("line %d doesn't exist in the content", line)
-	}
-	l += "\n"
 
-	var openParen *lsp.Position
-	var i int
-	for i = column; i >= 0; i-- {
-		if l[i] == '(' {
-			openParen = &lsp.Position{Line: line, Character: i}
-			break
+	for k := len(openParens) - 1; k >= 0; k-- {
+		open := openParens[k]
+		if open == 0 || tokens[open-1].Type != token.IDENT {
+			continue
 		}
+		parts := CommandCallParts{
+			Command:   tokens[open-1].Literal,
+			OpenParen: lsp.Position{Line: tokens[open].LineNumber - 1, Character: tokens[open].StartUtf8CharIndex},
+			Commas:    []lsp.Position{},
+		}
+		depth := 0
+	scan:
+		for _, t := range tokens[open:] {
+			switch t.Type {
+			case token.LPAREN:
+				depth++
+			case token.RPAREN:
+				depth--
+				if depth == 0 {
+					parts.CloseParen = lsp.Position{Line: t.LineNumber - 1, Character: t.StartUtf8CharIndex}
+					parts.Closed = true
+					break scan
+				}
+			case token.COMMA:
+				if depth == 1 {
+					parts.Commas = append(parts.Commas, lsp.Position{Line: t.LineNumber - 1, Character: t.StartUtf8CharIndex})
+				}
+			case token.LBRACE, token.RBRACE:
+				break scan
+			}
+		}
+		return parts, nil
+	}
+	return CommandCallParts{}, fmt.Errorf("position %d:%d isn't inside of a command call", line, column)
+}
+
+// Gets the index of the argument that contains the given position, which
+// must be inside of the call's parentheses.
+func (c CommandCallParts) GetArgIndex(position lsp.Position) int {
+	index := 0
+	for index < len(c.Commas) && isPositionBefore(c.Commas[index], position) {
+		index++
+	}
+	return index
+}
+
+// Returns true if position a comes before position b.
+func isPositionBefore(a lsp.Position, b lsp.Position) bool {
+	return a.Line < b.Line || (a.Line == b.Line && a.Character < b.Character)
+}
+
+// Applies an incremental LSP content change to the given document content,
+// and returns the updated content. A change without a range replaces the
+// entire document. Range positions are measured in UTF-16 code units, as
+// specified by the LSP.
+func ApplyContentChange(content string, change lsp.TextDocumentContentChangeEvent) (string, error) {
+	if change.Range == nil {
+		return change.Text, nil
 	}
-	if openParen == nil {
-		return CommandCallParts{}, fmt.Errorf("line %d doesn't have an open parenthesis", line)
+	start, err := positionToOffset(content, change.Range.Start)
+	if err != nil {
+		return "", err
 	}
-	i--
-	cmdEnd := i
-	for i >= 0 && wordRe.MatchString(string(l[i])) {
-		i--
+	end, err := positionToOffset(content, change.Range.End)
+	if err != nil {
+		return "", err
 	}
-	if i == cmdEnd {
-		return CommandCallParts{}, fmt.Errorf("line %d had no command before the parenthesis", line)
+	if end < start {
+		return "", fmt.Errorf("invalid content change range: end %d:%d is before start %d:%d", change.Range.End.Line, change.Range.End.Character, change.Range.Start.Line, change.Range.Start.Character)
 	}
-	commandName := l[i+1 : openParen.Character]
+	return content[:start] + change.Text + content[end:], nil
+}
 
-	var closeParen *lsp.Position
-	commas := []lsp.Position{}
-	for i = openParen.Character; i < len(l); i++ {
-		if l[i] == ')' {
-			closeParen = &lsp.Position{Line: line, Character: i}
-			break
-		} else if l[i] == ',' {
-			commas = append(commas, lsp.Position{Line: line, Character: i})
+// Converts an LSP position into a byte offset in the given content. Positions
+// past the end of a line resolve to the end of that line, and lines past the
+// end of the content resolve to the end of the content.
+func positionToOffset(content string, position lsp.Position) (int, error) {
+	if position.Line < 0 || position.Character < 0 {
+		return 0, fmt.Errorf("invalid position %d:%d", position.Line, position.Character)
+	}
+	offset := 0
+	for line := 0; line < position.Line; line++ {
+		i := strings.IndexByte(content[offset:], '\n')
+		if i < 0 {
+			return len(content), nil
 		}
+		offset += i + 1
 	}
-	if closeParen == nil {
-		return CommandCallParts{}, fmt.Errorf("line %d doesn't have a closing parenthesis", line)
+	lineEnd := len(content)
+	if i := strings.IndexByte(content[offset:], '\n'); i >= 0 {
+		lineEnd = offset + i
+	}
+	if lineEnd > offset && content[lineEnd-1] == '\r' {
+		lineEnd--
+	}
+	units := 0
+	for i, r := range content[offset:lineEnd] {
+		if units >= position.Character {
+			return offset + i, nil
+		}
+		if r >= 0x10000 {
+			units += 2
+		} else {
+			units++
+		}
 	}
+	return lineEnd, nil
+}
 
-	return CommandCallParts{
-		Command:    commandName,
-		OpenParen:  *openParen,
-		CloseParen: *closeParen,
-		Commas:     commas,
-	}, nil
+// Gets the source lines covered by the given range, for previewing a
+// definition. At most maxLines lines are returned, followed by "..." if
+// the range is longer. Indentation that is common to every line is removed.
+func GetRangePreview(content string, r lsp.Range, maxLines int) string {
+	lines := strings.Split(content, "\n")
+	if r.Start.Line < 0 || r.Start.Line >= len(lines) {
+		return ""
+	}
+	end := r.End.Line
+	if end >= len(lines) {
+		end = len(lines) - 1
+	}
+	truncated := false
+	if end-r.Start.Line+1 > maxLines {
+		end = r.Start.Line + maxLines - 1
+		truncated = true
+	}
+	previewLines := []string{}
+	for _, line := range lines[r.Start.Line : end+1] {
+		previewLines = append(previewLines, strings.TrimRight(line, " \t\r"))
+	}
+	indent := ""
+	first := true
+	for _, line := range previewLines {
+		if len(strings.TrimSpace(line)) == 0 {
+			continue
+		}
+		lineIndent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+		if first {
+			indent = lineIndent
+			first = false
+		}
+		for !strings.HasPrefix(lineIndent, indent) {
+			indent = indent[:len(indent)-1]
+		}
+	}
+	for i, line := range previewLines {
+		previewLines[i] = strings.TrimPrefix(line, indent)
+	}
+	if truncated {
+		previewLines = append(previewLines, "...")
+	}
+	return strings.Join(previewLines, "\n")
 }
@@ -1,7 +1,10 @@
 package parse
 
 import (
+	"reflect"
 	"testing"
+
+	"github.com/huderlem/poryscript-pls/lsp"
 )
 
 func TestGetTokenAt(t *testing.T) {
@@ -49,3 +52,154 @@ FOO 	thing(BLAH)	BAZ // COMMENT
 		}
 	}
 }
+
+func TestGetTokenPrefixAt(t *testing.T) {
+	input := "script Foo {\r\n\tgoto_if_set(FLAG_1, My)\n\tmsg # comment\n}"
+	tests := []struct {
+		line     int
+		column   int
+		expected string
+	}{
+		{line: -1, column: 0, expected: ""},
+		{line: 0, column: 0, expected: ""},
+		{line: 0, column: 3, expected: "scr"},
+		{line: 0, column: 6, expected: "script"},
+		{line: 0, column: 7, expected: ""},
+		{line: 1, column: 6, expected: "goto_"},
+		{line: 1, column: 13, expected: ""},
+		{line: 1, column: 18, expected: "FLAG_"},
+		{line: 1, column: 23, expected: "My"},
+		{line: 2, column: 4, expected: "msg"},
+		{line: 2, column: 9, expected: ""},
+		{line: 2, column: 99, expected: ""},
+		{line: 9, column: 0, expected: ""},
+	}
+	for i, tt := range tests {
+		result := GetTokenPrefixAt(input, tt.line, tt.column)
+		if result != tt.expected {
+			t.Errorf("Test Case %d: Expected: '%s', Got: '%s'", i, tt.expected, result)
+		}
+	}
+}
+
+func TestGetCommandCallParts(t *testing.T) {
+	pos := func(line, character int) lsp.Position {
+		return lsp.Position{Line: line, Character: character}
+	}
+	tests := []struct {
+		input    string
+		expected CommandCallParts
+		argIndex int
+	}{
+		{
+			input:    "script Foo {\n\tmsgbox(|)\n}",
+			expected: CommandCallParts{Command: "msgbox", OpenParen: pos(1, 7), CloseParen: pos(1, 8), Closed: true, Commas: []lsp.Position{}},
+		},
+		{
+			input:    "script Foo {\n\tmsgbox(\"a, (b)\", |MSGBOX_DEFAULT)\n}",
+			expected: CommandCallParts{Command: "msgbox", OpenParen: pos(1, 7), CloseParen: pos(1, 32), Closed: true, Commas: []lsp.Position{pos(1, 16)}},
+			argIndex: 1,
+		},
+		{
+			input:    "script Foo {\n\ttrainerbattle_single(TRAINER_X,\n\t\tText_Intro,\n\t\t|Text_Defeat)\n}",
+			expected: CommandCallParts{Command: "trainerbattle_single", OpenParen: pos(1, 21), CloseParen: pos(3, 13), Closed: true, Commas: []lsp.Position{pos(1, 31), pos(2, 12)}},
+			argIndex: 2,
+		},
+		{
+			input:    "script Foo {\n\tmsgbox(format(\"Hi|, there\"), MSGBOX_SIGN)\n}",
+			expected: CommandCallParts{Command: "msgbox", OpenParen: pos(1, 7), CloseParen: pos(1, 40), Closed: true, Commas: []lsp.Position{pos(1, 27)}},
+		},
+		{
+			input:    "script Foo {\n\tsetflag(|\n}",
+			expected: CommandCallParts{Command: "setflag", OpenParen: pos(1, 8), Commas: []lsp.Position{}},
+		},
+	}
+	for i, tt := range tests {
+		content, position := splitCursor(tt.input)
+		result, err := GetCommandCallParts(content, position.Line, position.Character)
+		if err != nil {
+			t.Fatalf("Test Case %d: Unexpected error: %s", i, err)
+		}
+		if !reflect.DeepEqual(result, tt.expected) {
+			t.Errorf("Test Case %d:\nExpected:\n%+v\n\nGot:\n%+v", i, tt.expected, result)
+		}
+		if argIndex := result.GetArgIndex(position); argIndex != tt.argIndex {
+			t.Errorf("Test Case %d: Expected argument %d, but got %d", i, tt.argIndex, argIndex)
+		}
+	}
+
+	for i, input := range []string{
+		"script Foo {\n\tmsgbox()|\n}",
+		"script Foo {\n\tmsgbox|()\n}",
+		"script Foo {\n\tif (var(|VAR_1) == 1) {}\n}",
+	} {
+		content, position := splitCursor(input)
+		if _, err := GetCommandCallParts(content, position.Line, position.Character); err == nil {
+			t.Errorf("Test Case %d: Expected an error for a position outside of a command call", i)
+		}
+	}
+}
+
+func TestApplyContentChange(t *testing.T) {
+	input := "script Foo {\r\n\tmsgbox(\"😀 hi\")\n}\n"
+	span := func(startLine, startChar, endLine, endChar int) *lsp.Range {
+		return &lsp.Range{
+			Start: lsp.Position{Line: startLine, Character: startChar},
+			End:   lsp.Position{Line: endLine, Character: endChar},
+		}
+	}
+	tests := []struct {
+		change   lsp.TextDocumentContentChangeEvent
+		expected string
+	}{
+		{change: lsp.TextDocumentContentChangeEvent{Text: "text Bar {}"}, expected: "text Bar {}"},
+		{change: lsp.TextDocumentContentChangeEvent{Range: span(0, 7, 0, 10), Text: "Bar"}, expected: "script Bar {\r\n\tmsgbox(\"😀 hi\")\n}\n"},
+		{change: lsp.TextDocumentContentChangeEvent{Range: span(0, 12, 0, 99), Text: " // x"}, expected: "script Foo { // x\r\n\tmsgbox(\"😀 hi\")\n}\n"},
+		{change: lsp.TextDocumentContentChangeEvent{Range: span(1, 9, 1, 12), Text: ""}, expected: "script Foo {\r\n\tmsgbox(\"hi\")\n}\n"},
+		{change: lsp.TextDocumentContentChangeEvent{Range: span(1, 12, 1, 14), Text: "yo"}, expected: "script Foo {\r\n\tmsgbox(\"😀 yo\")\n}\n"},
+		{change: lsp.TextDocumentContentChangeEvent{Range: span(0, 12, 2, 0), Text: ""}, expected: "script Foo {}\n"},
+		{change: lsp.TextDocumentContentChangeEvent{Range: span(3, 0, 3, 0), Text: "raw `\n`\n"}, expected: "script Foo {\r\n\tmsgbox(\"😀 hi\")\n}\nraw `\n`\n"},
+		{change: lsp.TextDocumentContentChangeEvent{Range: span(9, 0, 9, 0), Text: "#"}, expected: "script Foo {\r\n\tmsgbox(\"😀 hi\")\n}\n#"},
+	}
+	for i, tt := range tests {
+		result, err := ApplyContentChange(input, tt.change)
+		if err != nil {
+			t.Fatalf("Test Case %d: Unexpected error: %s", i, err)
+		}
+		if result != tt.expected {
+			t.Errorf("Test Case %d: Expected: %q, Got: %q", i, tt.expected, result)
+		}
+	}
+
+	if _, err := ApplyContentChange(input, lsp.TextDocumentContentChangeEvent{Range: span(1, 4, 0, 2)}); err == nil {
+		t.Errorf("Expected error for a range that ends before it starts")
+	}
+	if _, err := ApplyContentChange(input, lsp.TextDocumentContentChangeEvent{Range: span(-1, 0, 0, 2)}); err == nil {
+		t.Errorf("Expected error for a negative position")
+	}
+}
+
+func TestGetRangePreview(t *testing.T) {
+	input := "const FOO = 1\nscript Foo {\n\tlock\n\tif (flag(FLAG_1)) {\n\t\trelease\n\t}\n\tend\n}\n\tMyLabel:  \n"
+	span := func(startLine, endLine int) lsp.Range {
+		return lsp.Range{Start: lsp.Position{Line: startLine}, End: lsp.Position{Line: endLine}}
+	}
+	tests := []struct {
+		r        lsp.Range
+		maxLines int
+		expected string
+	}{
+		{r: span(0, 0), maxLines: 5, expected: "const FOO = 1"},
+		{r: span(1, 7), maxLines: 10, expected: "script Foo {\n\tlock\n\tif (flag(FLAG_1)) {\n\t\trelease\n\t}\n\tend\n}"},
+		{r: span(1, 7), maxLines: 3, expected: "script Foo {\n\tlock\n\tif (flag(FLAG_1)) {\n..."},
+		{r: span(3, 5), maxLines: 10, expected: "if (flag(FLAG_1)) {\n\trelease\n}"},
+		{r: span(8, 8), maxLines: 10, expected: "MyLabel:"},
+		{r: span(20, 21), maxLines: 10, expected: ""},
+	}
+	for i, tt := range tests {
+		result := GetRangePreview(input, tt.r, tt.maxLines)
+		if result != tt.expected {
+			t.Errorf("Test Case %d: Expected: %q, Got: %q", i, tt.expected, result)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package parse
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/huderlem/poryscript-pls/lsp"
+	"github.com/huderlem/poryscript/ast"
+	"github.com/huderlem/poryscript/token"
+)
+
+// Gets the folding ranges for the given file content. The top-level blocks
+// come from the parsed program. If program is nil, because the file doesn't
+// parse, every pair of braces and every raw section is folded instead.
+// Blocks fold up to the line before their closing brace, so that the brace
+// stays visible. Consecutive comment lines and strings concatenated across
+// multiple lines are also folded.
+func GetFoldingRanges(program *ast.Program, content string) []lsp.FoldingRange {
+	tokens := Tokenize(content)
+	var ranges []lsp.FoldingRange
+	if program != nil {
+		ranges = getProgramFoldingRanges(program, tokens)
+	} else {
+		ranges = getBraceFoldingRanges(tokens)
+		for _, t := range tokens {
+			if t.Type == token.RAWSTRING {
+				ranges = appendFoldingRange(ranges, t.LineNumber-1, t.EndLineNumber-2, "")
+			}
+		}
+	}
+	ranges = append(ranges, getCaseFoldingRanges(tokens)...)
+	ranges = append(ranges, getStringFoldingRanges(tokens)...)
+	ranges = append(ranges, getCommentFoldingRanges(content, tokens)...)
+	return sortFoldingRanges(ranges)
+}
+
+// Gets the folding ranges for the top-level statements of a parsed program,
+// and for the nested blocks inside of its scripts.
+func getProgramFoldingRanges(program *ast.Program, tokens []token.Token) []lsp.FoldingRange {
+	ranges := []lsp.FoldingRange{}
+	addBlock := func(keyword token.Token) (int, int) {
+		start := FindTokenIndex(tokens, keyword)
+		end := FindBlockEnd(tokens, start)
+		if start < 0 || end < 0 {
+			return -1, -1
+		}
+		ranges = appendFoldingRange(ranges, tokens[start].LineNumber-1, tokens[end].LineNumber-2, "")
+		return start, end
+	}
+	for _, topStatement := range program.TopLevelStatements {
+		switch statement := topStatement.(type) {
+		case *ast.ScriptStatement:
+			if start, end := addBlock(statement.Token); start >= 0 {
+				// The script's own braces are skipped, since it's already folded.
+				ranges = append(ranges, getBraceFoldingRanges(tokens[start+1:end])...)
+			}
+		case *ast.TextStatement:
+			addBlock(statement.Token)
+		case *ast.MovementStatement:
+			addBlock(statement.Token)
+		case *ast.MartStatement:
+			addBlock(statement.Token)
+		case *ast.MapScriptsStatement:
+			addBlock(statement.Token)
+		case *ast.RawStatement:
+			start := FindTokenIndex(tokens, statement.Token)
+			if start < 0 || start+1 >= len(tokens) || tokens[start+1].Type != token.RAWSTRING {
+				continue
+			}
+			ranges = appendFoldingRange(ranges, tokens[start].LineNumber-1, tokens[start+1].EndLineNumber-2, "")
+		}
+	}
+	return ranges
+}
+
+// Gets the folding ranges for every matched pair of braces in the tokens.
+// Each range starts at the line of its opening brace.
+func getBraceFoldingRanges(tokens []token.Token) []lsp.FoldingRange {
+	ranges := []lsp.FoldingRange{}
+	openBraces := []token.Token{}
+	for _, t := range tokens {
+		switch t.Type {
+		case token.LBRACE:
+			openBraces = append(openBraces, t)
+		case token.RBRACE:
+			if len(openBraces) == 0 {
+				continue
+			}
+			open := openBraces[len(openBraces)-1]
+			openBraces = openBraces[:len(openBraces)-1]
+			ranges = appendFoldingRange(ranges, open.LineNumber-1, t.LineNumber-2, "")
+		}
+	}
+	return ranges
+}
+
+// Gets the folding ranges for the arms of switch statements. An arm spans
+// from its 'case' or 'default' to the line before the next arm, or the
+// switch's closing brace.
+func getCaseFoldingRanges(tokens []token.Token) []lsp.FoldingRange {
+	type block struct {
+		isSwitch bool
+		armStart int
+	}
+	ranges := []lsp.FoldingRange{}
+	blocks := []block{}
+	pendingSwitch := false
+	for _, t := range tokens {
+		switch t.Type {
+		case token.SWITCH:
+			pendingSwitch = true
+		case token.LBRACE:
+			blocks = append(blocks, block{isSwitch: pendingSwitch, armStart: -1})
+			pendingSwitch = false
+		case token.RBRACE:
+			if len(blocks) == 0 {
+				continue
+			}
+			b := blocks[len(blocks)-1]
+			blocks = blocks[:len(blocks)-1]
+			if b.isSwitch && b.armStart >= 0 {
+				ranges = appendFoldingRange(ranges, b.armStart, t.LineNumber-2, "")
+			}
+		case token.CASE, token.DEFAULT:
+			if len(blocks) == 0 || !blocks[len(blocks)-1].isSwitch {
+				continue
+			}
+			b := &blocks[len(blocks)-1]
+			if b.armStart >= 0 {
+				ranges = appendFoldingRange(ranges, b.armStart, t.LineNumber-2, "")
+			}
+			b.armStart = t.LineNumber - 1
+		}
+	}
+	return ranges
+}
+
+// Gets the folding ranges for strings that are concatenated across multiple
+// lines, such as long text.
+func getStringFoldingRanges(tokens []token.Token) []lsp.FoldingRange {
+	ranges := []lsp.FoldingRange{}
+	for i := 0; i < len(tokens); i++ {
+		if tokens[i].Type != token.STRING {
+			continue
+		}
+		end := i
+		for end+1 < len(tokens) && tokens[end+1].Type == token.STRING {
+			end++
+		}
+		ranges = appendFoldingRange(ranges, tokens[i].LineNumber-1, tokens[end].EndLineNumber-1, "")
+		i = end
+	}
+	return ranges
+}
+
+// Gets the folding ranges for runs of consecutive lines that only contain
+// comments. Lines inside of raw sections aren't comments.
+func getCommentFoldingRanges(content string, tokens []token.Token) []lsp.FoldingRange {
+	rawLines := map[int]bool{}
+	for _, t := range tokens {
+		if t.Type == token.RAWSTRING {
+			for line := t.LineNumber - 1; line < t.EndLineNumber; line++ {
+				rawLines[line] = true
+			}
+		}
+	}
+	ranges := []lsp.FoldingRange{}
+	start := -1
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if len(line) > 0 && len(stripComment(line)) == 0 && !rawLines[i] {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			ranges = appendFoldingRange(ranges, start, i-1, lsp.FRKComment)
+			start = -1
+		}
+	}
+	if start >= 0 {
+		ranges = appendFoldingRange(ranges, start, len(lines)-1, lsp.FRKComment)
+	}
+	return ranges
+}
+
+// Appends a folding range, unless it spans fewer than two lines.
+func appendFoldingRange(ranges []lsp.FoldingRange, startLine int, endLine int, kind lsp.FoldingRangeKind) []lsp.FoldingRange {
+	if endLine <= startLine {
+		return ranges
+	}
+	return append(ranges, lsp.FoldingRange{StartLine: startLine, EndLine: endLine, Kind: kind})
+}
+
+// Sorts the folding ranges by their start lines. Since clients only allow
+// one range to start on each line, only the longest range is kept for each
+// start line.
+func sortFoldingRanges(ranges []lsp.FoldingRange) []lsp.FoldingRange {
+	sort.SliceStable(ranges, func(i, j int) bool {
+		if ranges[i].StartLine != ranges[j].StartLine {
+			return ranges[i].StartLine < ranges[j].StartLine
+		}
+		return ranges[i].EndLine > ranges[j].EndLine
+	})
+	result := []lsp.FoldingRange{}
+	for _, r := range ranges {
+		if len(result) > 0 && result[len(result)-1].StartLine == r.StartLine {
+			continue
+		}
+		result = append(result, r)
+	}
+	return result
+}
@@ -0,0 +1,80 @@
+package parse
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/huderlem/poryscript-pls/lsp"
+)
+
+func TestGetFoldingRangesFallback(t *testing.T) {
+	input := `# This file has
+# a header comment.
+script MyScript {
+	if (flag(FLAG_TEST)) {
+		msgbox("Hello"
+		       "there")
+	}
+	switch (var(VAR_TEST)) {
+		case 0:
+			end
+		default:
+			release
+			end
+	}
+}
+raw ` + "`" + `
+# not a comment
+# either
+` + "`" + `
+text MyText { "one line" }`
+	expected := []lsp.FoldingRange{
+		{StartLine: 0, EndLine: 1, Kind: lsp.FRKComment},
+		{StartLine: 2, EndLine: 13},
+		{StartLine: 3, EndLine: 5},
+		{StartLine: 4, EndLine: 5},
+		{StartLine: 7, EndLine: 12},
+		{StartLine: 8, EndLine: 9},
+		{StartLine: 10, EndLine: 12},
+		{StartLine: 15, EndLine: 17},
+	}
+	results := GetFoldingRanges(nil, input)
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("Expected:\n%v\n\nGot:\n%v", expected, results)
+	}
+}
+
+func TestGetCommentFoldingRanges(t *testing.T) {
+	input := `// one
+// two
+script A {}
+# lone comment
+
+  # three
+  // four
+  # five`
+	expected := []lsp.FoldingRange{
+		{StartLine: 0, EndLine: 1, Kind: lsp.FRKComment},
+		{StartLine: 5, EndLine: 7, Kind: lsp.FRKComment},
+	}
+	results := getCommentFoldingRanges(input, Tokenize(input))
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("Expected:\n%v\n\nGot:\n%v", expected, results)
+	}
+}
+
+func TestSortFoldingRanges(t *testing.T) {
+	ranges := []lsp.FoldingRange{
+		{StartLine: 4, EndLine: 5},
+		{StartLine: 1, EndLine: 3},
+		{StartLine: 1, EndLine: 8},
+	}
+	expected := []lsp.FoldingRange{
+		{StartLine: 1, EndLine: 8},
+		{StartLine: 4, EndLine: 5},
+	}
+	results := sortFoldingRanges(ranges)
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("Expected:\n%v\n\nGot:\n%v", expected, results)
+	}
+}
@@ -0,0 +1,309 @@
+package parse
+
+import (
+	"strings"
+
+	"github.com/huderlem/poryscript-pls/lsp"
+	"github.com/huderlem/poryscript/token"
+)
+
+// Formats the given Poryscript file content. Lines are indented by their
+// block depth, the arms of switch statements are indented under their
+// 'case' labels, and spacing between tokens is normalized. Comments are
+// kept, runs of blank lines are collapsed into one, and the contents of
+// strings and raw sections are never changed.
+func Format(content string, options lsp.FormattingOptions) string {
+	f := newFormatter(content, options)
+	lines := f.formatLines(0, len(f.lines)-1)
+	for len(lines) > 0 && len(lines[0]) == 0 {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && len(lines[len(lines)-1]) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, f.newline) + f.newline
+}
+
+// Formats the lines from startLine to endLine, inclusive, of the given
+// Poryscript file content. The rest of the file is only used to find the
+// indentation of the lines. The formatted lines are returned without a
+// trailing newline.
+func FormatLines(content string, startLine int, endLine int, options lsp.FormattingOptions) string {
+	f := newFormatter(content, options)
+	return strings.Join(f.formatLines(startLine, endLine), f.newline)
+}
+
+// formatter holds the state for formatting a single file.
+type formatter struct {
+	lines   []string
+	newline string
+	indent  string
+	// The tokens that start on each line.
+	lineTokens [][]token.Token
+	// The indentation level of each line.
+	levels []int
+	// Whether each line is the continuation of a multi-line string or raw
+	// section, which is left as-is.
+	verbatim []bool
+}
+
+func newFormatter(content string, options lsp.FormattingOptions) *formatter {
+	f := &formatter{newline: "\n", indent: "\t"}
+	if strings.Contains(content, "\r\n") {
+		f.newline = "\r\n"
+	}
+	if options.InsertSpaces {
+		tabSize := options.TabSize
+		if tabSize <= 0 {
+			tabSize = 4
+		}
+		f.indent = strings.Repeat(" ", tabSize)
+	}
+	f.lines = strings.Split(content, "\n")
+	for i, line := range f.lines {
+		f.lines[i] = strings.TrimSuffix(line, "\r")
+	}
+	f.lineTokens = make([][]token.Token, len(f.lines))
+	f.verbatim = make([]bool, len(f.lines))
+	for _, t := range Tokenize(content) {
+		line := t.LineNumber - 1
+		if line < 0 || line >= len(f.lines) {
+			continue
+		}
+		f.lineTokens[line] = append(f.lineTokens[line], t)
+		for l := line + 1; l < t.EndLineNumber && l < len(f.lines); l++ {
+			f.verbatim[l] = true
+		}
+	}
+	f.levels = getIndentLevels(f.lineTokens)
+	return f
+}
+
+// Gets the indentation level of each line, based on the tokens that start
+// on the line and the blocks and parentheses that are open before it.
+// Lines inside of unclosed parentheses are indented one extra level.
+func getIndentLevels(lineTokens [][]token.Token) []int {
+	type block struct {
+		isSwitch bool
+		inArm    bool
+	}
+	blocks := []block{}
+	parenDepth := 0
+	pendingSwitch := false
+	blockLevel := func(blocks []block) int {
+		level := 0
+		for _, b := range blocks {
+			level++
+			if b.inArm {
+				level++
+			}
+		}
+		return level
+	}
+
+	levels := make([]int, len(lineTokens))
+	for i, tokens := range lineTokens {
+		level := blockLevel(blocks)
+		if parenDepth > 0 {
+			level++
+		}
+		if len(tokens) > 0 {
+			switch tokens[0].Type {
+			case token.RBRACE:
+				if len(blocks) > 0 {
+					level = blockLevel(blocks[:len(blocks)-1])
+				}
+			case token.CASE, token.DEFAULT:
+				if len(blocks) > 0 && blocks[len(blocks)-1].isSwitch && blocks[len(blocks)-1].inArm {
+					level--
+				}
+			case token.RPAREN, token.RBRACKET:
+				if parenDepth > 0 {
+					level--
+				}
+			}
+		}
+		levels[i] = level
+
+		for _, t := range tokens {
+			switch t.Type {
+			case token.SWITCH:
+				pendingSwitch = true
+			case token.LBRACE:
+				blocks = append(blocks, block{isSwitch: pendingSwitch})
+				pendingSwitch = false
+				parenDepth = 0
+			case token.RBRACE:
+				if len(blocks) > 0 {
+					blocks = blocks[:len(blocks)-1]
+				}
+				parenDepth = 0
+			case token.LPAREN, token.LBRACKET:
+				parenDepth++
+			case token.RPAREN, token.RBRACKET:
+				if parenDepth > 0 {
+					parenDepth--
+				}
+			case token.CASE, token.DEFAULT:
+				if len(blocks) > 0 && blocks[len(blocks)-1].isSwitch {
+					blocks[len(blocks)-1].inArm = true
+				}
+			}
+		}
+	}
+	return levels
+}
+
+// Formats the lines from startLine to endLine, inclusive.
+func (f *formatter) formatLines(startLine int, endLine int) []string {
+	if startLine < 0 {
+		startLine = 0
+	}
+	if endLine >= len(f.lines) {
+		endLine = len(f.lines) - 1
+	}
+	result := []string{}
+	for i := startLine; i <= endLine; i++ {
+		if f.verbatim[i] {
+			result = append(result, f.lines[i])
+			continue
+		}
+		line := f.formatLine(i)
+		if len(line) == 0 && len(result) > 0 && len(result[len(result)-1]) == 0 && !f.verbatim[i-1] {
+			continue
+		}
+		result = append(result, line)
+	}
+	return result
+}
+
+// Formats a single line that isn't the continuation of a multi-line token.
+func (f *formatter) formatLine(i int) string {
+	chars := []rune(f.lines[i])
+	tokens := f.lineTokens[i]
+	if len(tokens) == 0 {
+		text := strings.TrimSpace(f.lines[i])
+		if len(text) == 0 {
+			return ""
+		}
+		// The line only has a comment.
+		return strings.Repeat(f.indent, f.levels[i]) + text
+	}
+
+	var sb strings.Builder
+	sb.WriteString(strings.Repeat(f.indent, f.levels[i]))
+	for j, t := range tokens {
+		start, end := t.StartUtf8CharIndex, t.EndUtf8CharIndex
+		if t.EndLineNumber != t.LineNumber || end > len(chars) {
+			// The token continues onto the next lines, so the rest of this
+			// line is part of it.
+			end = len(chars)
+		}
+		if start > end {
+			start = end
+		}
+		if j > 0 {
+			prev := tokens[j-1]
+			hasGap := prev.EndUtf8CharIndex < start
+			sb.WriteString(getTokenSpacing(prev, t, hasGap))
+		}
+		sb.WriteString(string(chars[start:end]))
+		if end == len(chars) {
+			return strings.TrimRight(sb.String(), " \t")
+		}
+	}
+
+	last := tokens[len(tokens)-1]
+	if comment := strings.TrimSpace(string(chars[last.EndUtf8CharIndex:])); len(comment) > 0 {
+		sb.WriteString(" ")
+		sb.WriteString(comment)
+	}
+	return sb.String()
+}
+
+// Gets the spacing that goes between two adjacent tokens on the same line.
+// Pairs of tokens without a canonical spacing keep a single space if they
+// were originally separated.
+func getTokenSpacing(prev token.Token, next token.Token, hasGap bool) string {
+	switch {
+	case next.Type == token.COMMA || next.Type == token.RPAREN || next.Type == token.RBRACKET || next.Type == token.COLON:
+		return ""
+	case prev.Type == token.LPAREN || prev.Type == token.LBRACKET || prev.Type == token.NOT:
+		return ""
+	case prev.Type == token.COMMA || prev.Type == token.COLON || prev.Type == token.RBRACE:
+		return " "
+	case isBinaryOperator(prev.Type) || isBinaryOperator(next.Type):
+		return " "
+	case next.Type == token.LBRACE:
+		return " "
+	case next.Type == token.LPAREN:
+		switch prev.Type {
+		case token.IF, token.ELSEIF, token.WHILE, token.SWITCH:
+			return " "
+		case token.IDENT, token.FLAG, token.VAR, token.DEFEATED, token.FORMAT, token.PORYSWITCH:
+			return ""
+		}
+	}
+	if hasGap {
+		return " "
+	}
+	return ""
+}
+
+// Returns true if the token type is an operator that goes between two operands.
+func isBinaryOperator(t token.Type) bool {
+	switch t {
+	case token.ASSIGN, token.EQ, token.NEQ, token.LT, token.GT, token.LTE, token.GTE, token.AND, token.OR:
+		return true
+	}
+	return false
+}
+
+// Gets the edits for formatting while typing the given character at the
+// given position. Typing '}' or ':' re-indents a line that starts with a
+// closing brace or a 'case' label, and typing a newline after '{' indents
+// the new line.
+func FormatOnType(content string, position lsp.Position, ch string, options lsp.FormattingOptions) []lsp.TextEdit {
+	f := newFormatter(content, options)
+	line := position.Line
+	if line < 0 || line >= len(f.lines) || f.verbatim[line] {
+		return []lsp.TextEdit{}
+	}
+	tokens := f.lineTokens[line]
+	switch ch {
+	case "}":
+		if len(tokens) == 0 || tokens[0].Type != token.RBRACE {
+			return []lsp.TextEdit{}
+		}
+	case ":":
+		if len(tokens) == 0 || (tokens[0].Type != token.CASE && tokens[0].Type != token.DEFAULT) {
+			return []lsp.TextEdit{}
+		}
+	case "\n":
+		if line == 0 {
+			return []lsp.TextEdit{}
+		}
+		prevTokens := f.lineTokens[line-1]
+		if len(prevTokens) == 0 || prevTokens[len(prevTokens)-1].Type != token.LBRACE {
+			return []lsp.TextEdit{}
+		}
+	default:
+		return []lsp.TextEdit{}
+	}
+
+	indent := strings.Repeat(f.indent, f.levels[line])
+	current := f.lines[line][:len(f.lines[line])-len(strings.TrimLeft(f.lines[line], " \t"))]
+	if current == indent {
+		return []lsp.TextEdit{}
+	}
+	return []lsp.TextEdit{{
+		Range: lsp.Range{
+			Start: lsp.Position{Line: line, Character: 0},
+			End:   lsp.Position{Line: line, Character: len(current)},
+		},
+		NewText: indent,
+	}}
+}
@@ -0,0 +1,147 @@
+package parse
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/huderlem/poryscript-pls/lsp"
+)
+
+func TestFormat(t *testing.T) {
+	input := "\n\n# Header comment\nconst FOO=5\n" +
+		"script MyScript{\n" +
+		"  lock\n" +
+		"    if(flag(FLAG_TEST)&&var(VAR_TEST)==FOO){\n" +
+		"msgbox( \"Hello,   world!\" ,MSGBOX_DEFAULT )   // say hi\n" +
+		"}\n" +
+		"    else {\n" +
+		"  setflag( FLAG_TEST )\n" +
+		"}\n" +
+		"\n\n\n" +
+		"switch (var(VAR_TEST)) {\n" +
+		"case 0:\n" +
+		"end\n" +
+		"  case 1 :\n" +
+		"release\n" +
+		"end\n" +
+		"default: end\n" +
+		"}\n" +
+		"MyLabel:\n" +
+		"msgbox(\"One\"\n" +
+		"\"Two\")\n" +
+		"}\n" +
+		"raw `\n" +
+		"   Keep   this\n" +
+		"\n\n" +
+		"`\n\n"
+	expected := "# Header comment\n" +
+		"const FOO = 5\n" +
+		"script MyScript {\n" +
+		"\tlock\n" +
+		"\tif (flag(FLAG_TEST) && var(VAR_TEST) == FOO) {\n" +
+		"\t\tmsgbox(\"Hello,   world!\", MSGBOX_DEFAULT) // say hi\n" +
+		"\t}\n" +
+		"\telse {\n" +
+		"\t\tsetflag(FLAG_TEST)\n" +
+		"\t}\n" +
+		"\n" +
+		"\tswitch (var(VAR_TEST)) {\n" +
+		"\t\tcase 0:\n" +
+		"\t\t\tend\n" +
+		"\t\tcase 1:\n" +
+		"\t\t\trelease\n" +
+		"\t\t\tend\n" +
+		"\t\tdefault: end\n" +
+		"\t}\n" +
+		"\tMyLabel:\n" +
+		"\tmsgbox(\"One\"\n" +
+		"\t\t\"Two\")\n" +
+		"}\n" +
+		"raw `\n" +
+		"   Keep   this\n" +
+		"\n\n" +
+		"`\n"
+	result := Format(input, lsp.FormattingOptions{TabSize: 4})
+	if result != expected {
+		t.Errorf("Expected:\n%s\n\nGot:\n%s", expected, result)
+	}
+	if again := Format(result, lsp.FormattingOptions{TabSize: 4}); again != result {
+		t.Errorf("Formatting isn't stable. Expected:\n%s\n\nGot:\n%s", result, again)
+	}
+}
+
+func TestFormatInsertSpaces(t *testing.T) {
+	input := "script A {\r\nif (flag(FLAG_A)) {\r\nend\r\n}\r\n}"
+	expected := "script A {\r\n  if (flag(FLAG_A)) {\r\n    end\r\n  }\r\n}\r\n"
+	result := Format(input, lsp.FormattingOptions{TabSize: 2, InsertSpaces: true})
+	if result != expected {
+		t.Errorf("Expected:\n%q\n\nGot:\n%q", expected, result)
+	}
+}
+
+func TestFormatLines(t *testing.T) {
+	input := "script A {\n  lock\n      msgbox( \"Hi\" )\n   release\n}"
+	expected := "\tlock\n\tmsgbox(\"Hi\")"
+	result := FormatLines(input, 1, 2, lsp.FormattingOptions{TabSize: 4})
+	if result != expected {
+		t.Errorf("Expected:\n%q\n\nGot:\n%q", expected, result)
+	}
+}
+
+func TestFormatOnType(t *testing.T) {
+	tests := []struct {
+		input    string
+		position lsp.Position
+		ch       string
+		expected []lsp.TextEdit
+	}{
+		{
+			input:    "script A {\n\tif (flag(FLAG_A)) {\n\t\tend\n\t\t}",
+			position: lsp.Position{Line: 3, Character: 3},
+			ch:       "}",
+			expected: []lsp.TextEdit{{Range: lsp.Range{Start: lsp.Position{Line: 3, Character: 0}, End: lsp.Position{Line: 3, Character: 2}}, NewText: "\t"}},
+		},
+		{
+			input:    "script A {\n\tend }",
+			position: lsp.Position{Line: 1, Character: 6},
+			ch:       "}",
+			expected: []lsp.TextEdit{},
+		},
+		{
+			input:    "script A {\n\tswitch (var(VAR_A)) {\n\t\tcase 0:\n\t\t\tend\n\t\t\tcase 1:",
+			position: lsp.Position{Line: 4, Character: 10},
+			ch:       ":",
+			expected: []lsp.TextEdit{{Range: lsp.Range{Start: lsp.Position{Line: 4, Character: 0}, End: lsp.Position{Line: 4, Character: 3}}, NewText: "\t\t"}},
+		},
+		{
+			input:    "script A {\n\tMyLabel:",
+			position: lsp.Position{Line: 1, Character: 9},
+			ch:       ":",
+			expected: []lsp.TextEdit{},
+		},
+		{
+			input:    "script A {\n\tif (flag(FLAG_A)) {\n",
+			position: lsp.Position{Line: 2, Character: 0},
+			ch:       "\n",
+			expected: []lsp.TextEdit{{Range: lsp.Range{Start: lsp.Position{Line: 2, Character: 0}, End: lsp.Position{Line: 2, Character: 0}}, NewText: "\t\t"}},
+		},
+		{
+			input:    "script A {\n\tlock\n\t",
+			position: lsp.Position{Line: 2, Character: 1},
+			ch:       "\n",
+			expected: []lsp.TextEdit{},
+		},
+		{
+			input:    "raw `\n  }",
+			position: lsp.Position{Line: 1, Character: 3},
+			ch:       "}",
+			expected: []lsp.TextEdit{},
+		},
+	}
+	for i, tt := range tests {
+		result := FormatOnType(tt.input, tt.position, tt.ch, lsp.FormattingOptions{TabSize: 4})
+		if !reflect.DeepEqual(result, tt.expected) {
+			t.Errorf("Test Case %d: Expected: %v, Got: %v", i, tt.expected, result)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package parse
+
+import (
+	"strings"
+	"unicode"
+)
+
+const (
+	fuzzyMatchScore       = 1
+	fuzzyConsecutiveBonus = 5
+	fuzzyBoundaryBonus    = 8
+	fuzzyCaseBonus        = 1
+	fuzzyPrefixBonus      = 20
+	fuzzyExactBonus       = 100
+	fuzzyMaxLeadingGap    = 3
+)
+
+// Fuzzy-matches the query against the candidate string. Every character of
+// the query must appear in the candidate, in order, ignoring case. Returns
+// false if the candidate doesn't match. Otherwise, returns a score where
+// higher is a better match. Matches that are consecutive, or that fall on
+// word boundaries such as "_" or a lowercase-to-uppercase transition, score
+// higher than scattered matches.
+func FuzzyMatch(query string, candidate string) (int, bool) {
+	if len(query) == 0 {
+		return 0, true
+	}
+	q := []rune(query)
+	c := []rune(candidate)
+	score := 0
+	prevMatch := -2
+	firstMatch := -1
+	ci := 0
+	for qi := range q {
+		match := indexFold(c, q[qi], ci)
+		if match < 0 {
+			return 0, false
+		}
+		// Unless the match continues a run of matches, prefer a later
+		// match on a word boundary, as long as the rest of the query
+		// still matches after it.
+		if match != prevMatch+1 {
+			for b := match; b < len(c); b++ {
+				if isWordBoundary(c, b) && unicode.ToLower(c[b]) == unicode.ToLower(q[qi]) && isSubsequenceFold(q[qi+1:], c[b+1:]) {
+					match = b
+					break
+				}
+			}
+		}
+		score += fuzzyMatchScore
+		if c[match] == q[qi] {
+			score += fuzzyCaseBonus
+		}
+		if match == prevMatch+1 {
+			score += fuzzyConsecutiveBonus
+		}
+		if isWordBoundary(c, match) {
+			score += fuzzyBoundaryBonus
+		}
+		if firstMatch < 0 {
+			firstMatch = match
+		}
+		prevMatch = match
+		ci = match + 1
+	}
+
+	if firstMatch > fuzzyMaxLeadingGap {
+		firstMatch = fuzzyMaxLeadingGap
+	}
+	score -= firstMatch
+	if strings.EqualFold(query, candidate) {
+		score += fuzzyExactBonus
+	} else if len(q) <= len(c) && strings.EqualFold(query, string(c[:len(q)])) {
+		score += fuzzyPrefixBonus
+	}
+	return score, true
+}
+
+// Returns true if the character at index i begins a new word in the
+// given identifier.
+func isWordBoundary(s []rune, i int) bool {
+	if i == 0 {
+		return true
+	}
+	prev, cur := s[i-1], s[i]
+	switch {
+	case prev == '_' || prev == '.' || prev == '-':
+		return true
+	case unicode.IsLower(prev) && unicode.IsUpper(cur):
+		return true
+	case unicode.IsLetter(prev) && unicode.IsDigit(cur):
+		return true
+	}
+	return false
+}
+
+// Finds the index of the first rune at or after start that equals r,
+// ignoring case. Returns -1 if there is no such rune.
+func indexFold(s []rune, r rune, start int) int {
+	for i := start; i < len(s); i++ {
+		if unicode.ToLower(s[i]) == unicode.ToLower(r) {
+			return i
+		}
+	}
+	return -1
+}
+
+// Returns true if every rune in sub appears in s, in order, ignoring case.
+func isSubsequenceFold(sub []rune, s []rune) bool {
+	i := 0
+	for _, r := range sub {
+		i = indexFold(s, r, i)
+		if i < 0 {
+			return false
+		}
+		i++
+	}
+	return true
+}
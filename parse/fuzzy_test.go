@@ -0,0 +1,49 @@
+package parse
+
+import "testing"
+
+func TestFuzzyMatch(t *testing.T) {
+	tests := []struct {
+		query     string
+		candidate string
+		expected  bool
+	}{
+		{query: "", candidate: "Anything", expected: true},
+		{query: "Lilycove_Mart", candidate: "LilycoveCity_Mart", expected: true},
+		{query: "lcm", candidate: "LilycoveCity_Mart", expected: true},
+		{query: "MART", candidate: "LilycoveCity_Mart", expected: true},
+		{query: "Mart_Lilycove", candidate: "LilycoveCity_Mart", expected: false},
+		{query: "Lilycove_Marts", candidate: "LilycoveCity_Mart", expected: false},
+		{query: "é", candidate: "Caféé", expected: true},
+	}
+	for i, tt := range tests {
+		if _, ok := FuzzyMatch(tt.query, tt.candidate); ok != tt.expected {
+			t.Errorf("Test Case %d: FuzzyMatch(%q, %q) Expected: %v, Got: %v", i, tt.query, tt.candidate, tt.expected, ok)
+		}
+	}
+}
+
+func TestFuzzyMatchRanking(t *testing.T) {
+	// Each candidate should be a better match for the query than the next one.
+	tests := []struct {
+		query      string
+		candidates []string
+	}{
+		{query: "Mart", candidates: []string{"Mart", "Mart_Items", "LilycoveCity_Mart", "SomethingMatter_t"}},
+		{query: "lcm", candidates: []string{"LilycoveCity_Mart", "LilycoveCitymart", "lxxcxxmxx"}},
+		{query: "Lilycove_Mart", candidates: []string{"Lilycove_Mart_Text", "LilycoveCity_Mart", "LilycoveCity_DepartmentStore_5F_Mart"}},
+	}
+	for i, tt := range tests {
+		prev := 0
+		for j, candidate := range tt.candidates {
+			score, ok := FuzzyMatch(tt.query, candidate)
+			if !ok {
+				t.Fatalf("Test Case %d: Expected %q to match %q", i, tt.query, candidate)
+			}
+			if j > 0 && score >= prev {
+				t.Errorf("Test Case %d: Expected %q (%d) to score lower than %q (%d)", i, candidate, score, tt.candidates[j-1], prev)
+			}
+			prev = score
+		}
+	}
+}
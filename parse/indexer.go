@@ -0,0 +1,202 @@
+package parse
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/huderlem/poryscript-pls/lsp"
+	"github.com/huderlem/poryscript/ast"
+	"github.com/huderlem/poryscript/token"
+)
+
+// FileIndex holds the definitions in a single Poryscript file.
+type FileIndex struct {
+	Symbols   []Symbol
+	Constants []ConstantSymbol
+}
+
+// Indexes the symbols and constants defined in the given file content. The
+// program is the file's parsed content, so declarations inside raw blocks
+// and strings are ignored, declarations may span multiple lines, and each
+// definition gets its full range. If program is nil, because the file
+// doesn't parse, this falls back to the line-based ParseSymbols and
+// ParseConstants, whose definitions only span their names and have an
+// unknown scope.
+func IndexFile(program *ast.Program, content string, fileUri string) FileIndex {
+	if len(content) == 0 {
+		return FileIndex{Symbols: []Symbol{}, Constants: []ConstantSymbol{}}
+	}
+	if program == nil {
+		return indexFileFallback(content, fileUri)
+	}
+	tokens := Tokenize(content)
+	return FileIndex{
+		Symbols:   indexProgramSymbols(program, tokens, fileUri),
+		Constants: indexConstants(content, tokens, fileUri),
+	}
+}
+
+// Indexes the given file content with the line-based regex scan.
+func indexFileFallback(content string, fileUri string) FileIndex {
+	index := FileIndex{
+		Symbols:   ParseSymbols(content, fileUri),
+		Constants: ParseConstants(content, fileUri),
+	}
+	for i, s := range index.Symbols {
+		index.Symbols[i].Range = s.ToLocation().Range
+	}
+	for i, c := range index.Constants {
+		index.Constants[i].Range = c.ToLocation().Range
+	}
+	return index
+}
+
+// Gets the symbols from the top-level statements of a parsed program, and
+// the labels inside of its scripts.
+func indexProgramSymbols(program *ast.Program, tokens []token.Token, fileUri string) []Symbol {
+	symbols := []Symbol{}
+	add := func(keyword token.Token, name *ast.Identifier, kind SymbolKind, scope token.Type) bool {
+		if name == nil {
+			return false
+		}
+		start := FindTokenIndex(tokens, keyword)
+		end := FindBlockEnd(tokens, start)
+		if start < 0 || end < 0 {
+			return false
+		}
+		symbols = append(symbols, Symbol{
+			Name:     name.Value,
+			Position: lsp.Position{Line: name.Token.LineNumber - 1, Character: name.Token.StartUtf8CharIndex},
+			Uri:      fileUri,
+			Kind:     kind,
+			Range:    TokenSpanToLSPRange(tokens[start], tokens[end]),
+			Scope:    getSymbolScope(scope),
+		})
+		return true
+	}
+	for _, topStatement := range program.TopLevelStatements {
+		switch statement := topStatement.(type) {
+		case *ast.ScriptStatement:
+			if add(statement.Token, statement.Name, SymbolKindScript, statement.Scope) {
+				symbols = append(symbols, indexLabels(statement, tokens, fileUri)...)
+			}
+		case *ast.TextStatement:
+			add(statement.Token, statement.Name, SymbolKindText, statement.Scope)
+		case *ast.MovementStatement:
+			add(statement.Token, statement.Name, SymbolKindMovementScript, statement.Scope)
+		case *ast.MartStatement:
+			add(statement.Token, statement.Name, SymbolKindMart, statement.Scope)
+		case *ast.MapScriptsStatement:
+			add(statement.Token, statement.Name, SymbolKindMapScripts, statement.Scope)
+		}
+	}
+	sortSymbolsByPosition(symbols)
+	return symbols
+}
+
+// Gets the labels inside of a script. A label spans from its name to its colon.
+func indexLabels(script *ast.ScriptStatement, tokens []token.Token, fileUri string) []Symbol {
+	labels := []Symbol{}
+	for _, statement := range script.AllChildren() {
+		label, ok := statement.(*ast.LabelStatement)
+		if !ok || label.Name == nil {
+			continue
+		}
+		start := FindTokenIndex(tokens, label.Name.Token)
+		if start < 0 {
+			continue
+		}
+		end := start
+		for end+1 < len(tokens) && tokens[end].Type != token.COLON {
+			end++
+		}
+		scope := SymbolScopeLocal
+		if label.IsGlobal {
+			scope = SymbolScopeGlobal
+		}
+		labels = append(labels, Symbol{
+			Name:     label.Name.Value,
+			Position: lsp.Position{Line: label.Name.Token.LineNumber - 1, Character: label.Name.Token.StartUtf8CharIndex},
+			Uri:      fileUri,
+			Kind:     SymbolKindLabel,
+			Range:    TokenSpanToLSPRange(tokens[start], tokens[end]),
+			Scope:    scope,
+			Parent:   script.Name.Value,
+		})
+	}
+	return labels
+}
+
+// Gets the top-level constants from the tokens, since they aren't part of
+// the parsed program. A constant's value is the rest of the line containing
+// its assignment, up to the next statement or block on that line, and the
+// constant spans to the end of its value.
+func indexConstants(content string, tokens []token.Token, fileUri string) []ConstantSymbol {
+	constants := []ConstantSymbol{}
+	lines := strings.Split(content, "\n")
+	depth := 0
+	for i, t := range tokens {
+		switch t.Type {
+		case token.LBRACE:
+			depth++
+		case token.RBRACE:
+			depth--
+		case token.CONST:
+			if depth != 0 || i+2 >= len(tokens) || tokens[i+1].Type != token.IDENT || tokens[i+2].Type != token.ASSIGN {
+				continue
+			}
+			assign := tokens[i+2]
+			end := i + 2
+			for end+1 < len(tokens) && tokens[end+1].LineNumber == assign.EndLineNumber && !endsConstantValue(tokens[end+1]) {
+				end++
+			}
+			value := ""
+			if line := assign.EndLineNumber - 1; line < len(lines) && tokens[end].EndLineNumber == assign.EndLineNumber {
+				chars := []rune(lines[line])
+				if tokens[end].EndUtf8CharIndex <= len(chars) {
+					value = strings.TrimSpace(string(chars[assign.EndUtf8CharIndex:tokens[end].EndUtf8CharIndex]))
+				}
+			}
+			name := tokens[i+1]
+			constants = append(constants, ConstantSymbol{
+				Name:     name.Literal,
+				Position: lsp.Position{Line: name.LineNumber - 1, Character: name.StartUtf8CharIndex},
+				Uri:      fileUri,
+				Value:    value,
+				Range:    TokenSpanToLSPRange(t, tokens[end]),
+			})
+		}
+	}
+	return constants
+}
+
+// Returns true if the token can't be part of a constant's value, because it
+// starts another top-level statement or changes the block depth.
+func endsConstantValue(t token.Token) bool {
+	switch t.Type {
+	case token.CONST, token.SCRIPT, token.TEXT, token.MOVEMENT, token.MART, token.MAPSCRIPTS, token.RAW,
+		token.LOCAL, token.GLOBAL, token.LBRACE, token.RBRACE:
+		return true
+	}
+	return false
+}
+
+// Gets the symbol scope for a Poryscript scope keyword. Symbols are global
+// unless they are declared local.
+func getSymbolScope(scope token.Type) SymbolScope {
+	if scope == token.LOCAL {
+		return SymbolScopeLocal
+	}
+	return SymbolScopeGlobal
+}
+
+// Sorts the symbols by the positions of their names.
+func sortSymbolsByPosition(symbols []Symbol) {
+	sort.SliceStable(symbols, func(i, j int) bool {
+		a, b := symbols[i].Position, symbols[j].Position
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Character < b.Character
+	})
+}
@@ -0,0 +1,270 @@
+package parse
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/huderlem/poryscript-pls/lsp"
+	"github.com/huderlem/poryscript/ast"
+	"github.com/huderlem/poryscript/token"
+)
+
+func TestIndexConstants(t *testing.T) {
+	input := `
+const FOO = 5 // comment
+raw ` + "`" + `
+const NOPE = 1
+` + "`" + `
+script MyScript {
+	msgbox("const NOPE2 = 2")
+}
+  const BAR = FOO + 1`
+	expected := []ConstantSymbol{
+		{
+			Name:     "FOO",
+			Position: lsp.Position{Line: 1, Character: 6},
+			Uri:      "test.pory",
+			Value:    "5",
+			Range:    lsp.Range{Start: lsp.Position{Line: 1, Character: 0}, End: lsp.Position{Line: 1, Character: 13}},
+		},
+		{
+			Name:     "BAR",
+			Position: lsp.Position{Line: 8, Character: 8},
+			Uri:      "test.pory",
+			Value:    "FOO + 1",
+			Range:    lsp.Range{Start: lsp.Position{Line: 8, Character: 2}, End: lsp.Position{Line: 8, Character: 21}},
+		},
+	}
+	results := indexConstants(input, Tokenize(input), "test.pory")
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("Expected:\n%v\n\nGot:\n%v", expected, results)
+	}
+}
+
+func TestIndexConstantsOnSameLine(t *testing.T) {
+	input := `
+const FOO = 54 + 3
+  	const BAR = 22 const BAZ = FOO
+const QUX = 1 script MyScript {}`
+	expected := []ConstantSymbol{
+		{
+			Name:     "FOO",
+			Position: lsp.Position{Line: 1, Character: 6},
+			Uri:      "test.pory",
+			Value:    "54 + 3",
+			Range:    lsp.Range{Start: lsp.Position{Line: 1, Character: 0}, End: lsp.Position{Line: 1, Character: 18}},
+		},
+		{
+			Name:     "BAR",
+			Position: lsp.Position{Line: 2, Character: 9},
+			Uri:      "test.pory",
+			Value:    "22",
+			Range:    lsp.Range{Start: lsp.Position{Line: 2, Character: 3}, End: lsp.Position{Line: 2, Character: 17}},
+		},
+		{
+			Name:     "BAZ",
+			Position: lsp.Position{Line: 2, Character: 24},
+			Uri:      "test.pory",
+			Value:    "FOO",
+			Range:    lsp.Range{Start: lsp.Position{Line: 2, Character: 18}, End: lsp.Position{Line: 2, Character: 33}},
+		},
+		{
+			Name:     "QUX",
+			Position: lsp.Position{Line: 3, Character: 6},
+			Uri:      "test.pory",
+			Value:    "1",
+			Range:    lsp.Range{Start: lsp.Position{Line: 3, Character: 0}, End: lsp.Position{Line: 3, Character: 13}},
+		},
+	}
+	results := indexConstants(input, Tokenize(input), "test.pory")
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("Expected:\n%v\n\nGot:\n%v", expected, results)
+	}
+}
+
+func TestIndexFileFallback(t *testing.T) {
+	input := `script MyScript {
+	MyLabel:
+}
+const FOO = 5`
+	expected := FileIndex{
+		Symbols: []Symbol{
+			{
+				Name:     "MyScript",
+				Position: lsp.Position{Line: 0, Character: 7},
+				Uri:      "test.pory",
+				Kind:     SymbolKindScript,
+				Range:    lsp.Range{Start: lsp.Position{Line: 0, Character: 7}, End: lsp.Position{Line: 0, Character: 15}},
+			},
+			{
+				Name:     "MyLabel",
+				Position: lsp.Position{Line: 1, Character: 1},
+				Uri:      "test.pory",
+				Kind:     SymbolKindLabel,
+				Range:    lsp.Range{Start: lsp.Position{Line: 1, Character: 1}, End: lsp.Position{Line: 1, Character: 8}},
+			},
+		},
+		Constants: []ConstantSymbol{
+			{
+				Name:     "FOO",
+				Position: lsp.Position{Line: 3, Character: 6},
+				Uri:      "test.pory",
+				Value:    "5",
+				Range:    lsp.Range{Start: lsp.Position{Line: 3, Character: 6}, End: lsp.Position{Line: 3, Character: 9}},
+			},
+		},
+	}
+	result := indexFileFallback(input, "test.pory")
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected:\n%v\n\nGot:\n%v", expected, result)
+	}
+	if !result.Symbols[1].IsFileLocal() {
+		t.Errorf("Labels with an unknown scope should be local to their file")
+	}
+}
+
+func TestIndexProgramSymbols(t *testing.T) {
+	input := `script MyScript {
+	msgbox("script Foo {")
+	MyLabel:
+	GlobalLabel(global):
+}
+raw ` + "`" + `
+script Bar {
+` + "`" + `
+local text MyText {
+	"Hello"
+}
+movement
+	MyMovement
+{
+	walk_up
+}
+mart MyMart { ITEM_POTION }
+mapscripts MyMapScripts {}`
+	tokens := Tokenize(input)
+	ident := func(name string) *ast.Identifier {
+		return &ast.Identifier{Token: findTestToken(tokens, name), Value: name}
+	}
+	program := &ast.Program{
+		TopLevelStatements: []ast.Statement{
+			&ast.ScriptStatement{
+				Token: findTestToken(tokens, "script"),
+				Name:  ident("MyScript"),
+				Body: &ast.BlockStatement{
+					Statements: []ast.Statement{
+						&ast.LabelStatement{Name: ident("MyLabel")},
+						&ast.LabelStatement{Name: ident("GlobalLabel"), IsGlobal: true},
+					},
+				},
+			},
+			&ast.RawStatement{Token: findTestToken(tokens, "raw")},
+			&ast.TextStatement{Token: findTestToken(tokens, "text"), Name: ident("MyText"), Scope: token.LOCAL},
+			&ast.MovementStatement{Token: findTestToken(tokens, "movement"), Name: ident("MyMovement")},
+			&ast.MartStatement{Token: findTestToken(tokens, "mart"), Name: ident("MyMart")},
+			&ast.MapScriptsStatement{Token: findTestToken(tokens, "mapscripts"), Name: ident("MyMapScripts")},
+		},
+	}
+	expected := []Symbol{
+		{
+			Name:     "MyScript",
+			Position: lsp.Position{Line: 0, Character: 7},
+			Uri:      "test.pory",
+			Kind:     SymbolKindScript,
+			Range:    lsp.Range{Start: lsp.Position{Line: 0, Character: 0}, End: lsp.Position{Line: 4, Character: 1}},
+			Scope:    SymbolScopeGlobal,
+		},
+		{
+			Name:     "MyLabel",
+			Position: lsp.Position{Line: 2, Character: 1},
+			Uri:      "test.pory",
+			Kind:     SymbolKindLabel,
+			Range:    lsp.Range{Start: lsp.Position{Line: 2, Character: 1}, End: lsp.Position{Line: 2, Character: 9}},
+			Scope:    SymbolScopeLocal,
+			Parent:   "MyScript",
+		},
+		{
+			Name:     "GlobalLabel",
+			Position: lsp.Position{Line: 3, Character: 1},
+			Uri:      "test.pory",
+			Kind:     SymbolKindLabel,
+			Range:    lsp.Range{Start: lsp.Position{Line: 3, Character: 1}, End: lsp.Position{Line: 3, Character: 21}},
+			Scope:    SymbolScopeGlobal,
+			Parent:   "MyScript",
+		},
+		{
+			Name:     "MyText",
+			Position: lsp.Position{Line: 8, Character: 11},
+			Uri:      "test.pory",
+			Kind:     SymbolKindText,
+			Range:    lsp.Range{Start: lsp.Position{Line: 8, Character: 6}, End: lsp.Position{Line: 10, Character: 1}},
+			Scope:    SymbolScopeLocal,
+		},
+		{
+			Name:     "MyMovement",
+			Position: lsp.Position{Line: 12, Character: 1},
+			Uri:      "test.pory",
+			Kind:     SymbolKindMovementScript,
+			Range:    lsp.Range{Start: lsp.Position{Line: 11, Character: 0}, End: lsp.Position{Line: 15, Character: 1}},
+			Scope:    SymbolScopeGlobal,
+		},
+		{
+			Name:     "MyMart",
+			Position: lsp.Position{Line: 16, Character: 5},
+			Uri:      "test.pory",
+			Kind:     SymbolKindMart,
+			Range:    lsp.Range{Start: lsp.Position{Line: 16, Character: 0}, End: lsp.Position{Line: 16, Character: 27}},
+			Scope:    SymbolScopeGlobal,
+		},
+		{
+			Name:     "MyMapScripts",
+			Position: lsp.Position{Line: 17, Character: 11},
+			Uri:      "test.pory",
+			Kind:     SymbolKindMapScripts,
+			Range:    lsp.Range{Start: lsp.Position{Line: 17, Character: 0}, End: lsp.Position{Line: 17, Character: 26}},
+			Scope:    SymbolScopeGlobal,
+		},
+	}
+	results := indexProgramSymbols(program, tokens, "test.pory")
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("Expected:\n%v\n\nGot:\n%v", expected, results)
+	}
+}
+
+func TestIndexFileWithoutProgram(t *testing.T) {
+	input := `script MyScript {
+	MyLabel:
+}`
+	result := IndexFile(nil, input, "test.pory")
+	expected := indexFileFallback(input, "test.pory")
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected:\n%v\n\nGot:\n%v", expected, result)
+	}
+}
+
+// Finds the first token with the given literal.
+func findTestToken(tokens []token.Token, literal string) token.Token {
+	for _, t := range tokens {
+		if t.Literal == literal {
+			return t
+		}
+	}
+	return token.Token{}
+}
+
+func TestSymbolIsFileLocal(t *testing.T) {
+	tests := []struct {
+		input    Symbol
+		expected bool
+	}{
+		{input: Symbol{Kind: SymbolKindScript, Scope: SymbolScopeLocal}, expected: false},
+		{input: Symbol{Kind: SymbolKindLabel, Scope: SymbolScopeLocal}, expected: true},
+		{input: Symbol{Kind: SymbolKindLabel, Scope: SymbolScopeGlobal}, expected: false},
+		{input: Symbol{Kind: SymbolKindLabel}, expected: true},
+	}
+	for i, tt := range tests {
+		if result := tt.input.IsFileLocal(); result != tt.expected {
+			t.Errorf("Test Case %d: Expected %v, but got %v", i, tt.expected, result)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package parse
+
+import (
+	"strings"
+	"unicode"
+
+	"github.com/huderlem/poryscript-pls/lsp"
+	"github.com/huderlem/poryscript/token"
+)
+
+// Reference represents a single use of an identifier in a Poryscript file.
+// Declarations are also references, since the declared name appears in
+// the file content.
+type Reference struct {
+	Name     string
+	Position lsp.Position
+	Uri      string
+}
+
+// Returns the lsp.Location representation of a Reference.
+func (r Reference) ToLocation() lsp.Location {
+	return lsp.Location{
+		URI: lsp.DocumentURI(r.Uri),
+		Range: lsp.Range{
+			Start: r.Position,
+			End: lsp.Position{
+				Line:      r.Position.Line,
+				Character: r.Position.Character + len(r.Name),
+			},
+		},
+	}
+}
+
+// Returns true if the given position falls on the Reference.
+func (r Reference) Contains(position lsp.Position) bool {
+	return position.Line == r.Position.Line &&
+		position.Character >= r.Position.Character &&
+		position.Character <= r.Position.Character+len(r.Name)
+}
+
+// ParseReferences finds every identifier used in the given file content.
+// Identifiers come from the lexer's tokens, so comments and string literals
+// are skipped, and positions use the same columns as the rest of the
+// server. The contents of raw sections are also scanned, since they often
+// refer to Poryscript symbols.
+func ParseReferences(content string, fileUri string) []Reference {
+	references := []Reference{}
+	if len(content) == 0 {
+		return references
+	}
+	var lines []string
+	for _, t := range Tokenize(content) {
+		switch t.Type {
+		case token.IDENT:
+			references = append(references, Reference{
+				Name:     t.Literal,
+				Position: lsp.Position{Line: t.LineNumber - 1, Character: t.StartUtf8CharIndex},
+				Uri:      fileUri,
+			})
+		case token.RAWSTRING:
+			if lines == nil {
+				lines = strings.Split(content, "\n")
+			}
+			references = append(references, parseRawReferences(lines, t, fileUri)...)
+		}
+	}
+	return references
+}
+
+// Finds the identifiers inside of a raw section, which the lexer reads as a
+// single token. String literals and assembly comments ('@', '//', and
+// '/* */') inside the section are skipped. Columns on the section's first
+// line are relative to the token's start.
+func parseRawReferences(lines []string, raw token.Token, fileUri string) []Reference {
+	references := []Reference{}
+	inBlockComment := false
+	for lineNumber := raw.LineNumber - 1; lineNumber < raw.EndLineNumber && lineNumber < len(lines); lineNumber++ {
+		chars := []rune(lines[lineNumber])
+		i, offset := 0, 0
+		if lineNumber == raw.LineNumber-1 {
+			// Skip the opening backtick.
+			i = strings.IndexRune(lines[lineNumber], '`')
+			if i < 0 {
+				continue
+			}
+			i = len([]rune(lines[lineNumber][:i])) + 1
+			offset = raw.StartUtf8CharIndex - (i - 1)
+		}
+		for i < len(chars) {
+			c := chars[i]
+			switch {
+			case c == '`':
+				return references
+			case inBlockComment:
+				if c == '*' && i+1 < len(chars) && chars[i+1] == '/' {
+					inBlockComment = false
+					i++
+				}
+				i++
+			case c == '/' && i+1 < len(chars) && chars[i+1] == '*':
+				inBlockComment = true
+				i += 2
+			case c == '@' || (c == '/' && i+1 < len(chars) && chars[i+1] == '/'):
+				i = skipLineComment(chars, i)
+			case c == '"':
+				i = skipStringLiteral(chars, i)
+			case isIdentifierStart(c):
+				start := i
+				for i < len(chars) && isIdentifierChar(chars[i]) {
+					i++
+				}
+				references = append(references, Reference{
+					Name:     string(chars[start:i]),
+					Position: lsp.Position{Line: lineNumber, Character: start + offset},
+					Uri:      fileUri,
+				})
+			case isIdentifierChar(c):
+				// Skip numbers, such as 0x8000, in their entirety.
+				for i < len(chars) && isIdentifierChar(chars[i]) {
+					i++
+				}
+			default:
+				i++
+			}
+		}
+	}
+	return references
+}
+
+// Advances past the comment starting at the given index, which runs to the
+// end of the line. The raw section's closing backtick still ends the
+// comment.
+func skipLineComment(chars []rune, index int) int {
+	i := index
+	for i < len(chars) && chars[i] != '`' {
+		i++
+	}
+	return i
+}
+
+// Advances past the string literal starting at the given index. Returns
+// the index immediately after the closing quote, or the end of the line
+// if the string is unterminated.
+func skipStringLiteral(chars []rune, index int) int {
+	i := index + 1
+	for i < len(chars) {
+		if chars[i] == '\\' {
+			i += 2
+			continue
+		}
+		if chars[i] == '"' {
+			return i + 1
+		}
+		i++
+	}
+	return len(chars)
+}
+
+func isIdentifierStart(c rune) bool {
+	return c == '_' || (c < unicode.MaxASCII && unicode.IsLetter(c))
+}
+
+func isIdentifierChar(c rune) bool {
+	return isIdentifierStart(c) || (c >= '0' && c <= '9')
+}
@@ -0,0 +1,100 @@
+package parse
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/huderlem/poryscript-pls/lsp"
+)
+
+func TestParseReferences(t *testing.T) {
+	input := `script MyScript { # MyComment
+	msgbox("MyString, NotAReference", MSGBOX_DEFAULT)
+	goto(MyScript) // Other
+}
+raw ` + "`" + `
+	.4byte MyText # still "NotAReference"
+` + "`"
+	expected := []Reference{
+		{Name: "MyScript", Position: lsp.Position{Line: 0, Character: 7}, Uri: "test.pory"},
+		{Name: "msgbox", Position: lsp.Position{Line: 1, Character: 1}, Uri: "test.pory"},
+		{Name: "MSGBOX_DEFAULT", Position: lsp.Position{Line: 1, Character: 35}, Uri: "test.pory"},
+		{Name: "goto", Position: lsp.Position{Line: 2, Character: 1}, Uri: "test.pory"},
+		{Name: "MyScript", Position: lsp.Position{Line: 2, Character: 6}, Uri: "test.pory"},
+		{Name: "MyText", Position: lsp.Position{Line: 5, Character: 8}, Uri: "test.pory"},
+		{Name: "still", Position: lsp.Position{Line: 5, Character: 17}, Uri: "test.pory"},
+	}
+	results := ParseReferences(input, "test.pory")
+	if len(expected) != len(results) {
+		t.Fatalf("Wrong number of parsed references. Expected=%d, Got=%d\n%v", len(expected), len(results), results)
+	}
+	for i, result := range results {
+		if !reflect.DeepEqual(result, expected[i]) {
+			t.Errorf("Test Case %d: parsed reference is wrong.\nExpected:\n%v\n\nGot:\n%v", i, expected[i], result)
+		}
+	}
+
+	if len(ParseReferences("", "test.pory")) != 0 {
+		t.Errorf("ParseReferences with empty string should return an empty array")
+	}
+}
+
+func TestParseReferencesUseLexerColumns(t *testing.T) {
+	input := "msgbox(\"Pokémon ★\", MyText) raw `é MyRaw`"
+	tokens := Tokenize(input)
+	references := ParseReferences(input, "test.pory")
+	if len(references) != 3 {
+		t.Fatalf("Expected 3 references, Got: %v", references)
+	}
+	// The identifier after the non-ASCII string is the call's fifth token.
+	if expected := tokens[4].StartUtf8CharIndex; references[1].Name != "MyText" || references[1].Position.Character != expected {
+		t.Errorf("Expected MyText at column %d, Got: %v", expected, references[1])
+	}
+	raw := tokens[len(tokens)-1]
+	if expected := raw.StartUtf8CharIndex + 3; references[2].Name != "MyRaw" || references[2].Position.Character != expected {
+		t.Errorf("Expected MyRaw at column %d, Got: %v", expected, references[2])
+	}
+}
+
+func TestParseRawReferencesSkipsComments(t *testing.T) {
+	input := "raw `\n" +
+		"\t.4byte MyText @ NotAReference\n" +
+		"\tgoto MyScript // NotAReference\n" +
+		"\t/* NotAReference\n" +
+		"\tNotAReference */ .2byte MyValue /* NotAReference */ MyOther\n" +
+		"\t.string \"@ NotAReference\" @ \"NotAReference\n" +
+		"@ comment` msgbox(AfterRaw)"
+	expected := []Reference{
+		{Name: "MyText", Position: lsp.Position{Line: 1, Character: 8}, Uri: "test.pory"},
+		{Name: "goto", Position: lsp.Position{Line: 2, Character: 1}, Uri: "test.pory"},
+		{Name: "MyScript", Position: lsp.Position{Line: 2, Character: 6}, Uri: "test.pory"},
+		{Name: "MyValue", Position: lsp.Position{Line: 4, Character: 25}, Uri: "test.pory"},
+		{Name: "MyOther", Position: lsp.Position{Line: 4, Character: 53}, Uri: "test.pory"},
+		{Name: "string", Position: lsp.Position{Line: 5, Character: 2}, Uri: "test.pory"},
+		{Name: "msgbox", Position: lsp.Position{Line: 6, Character: 11}, Uri: "test.pory"},
+		{Name: "AfterRaw", Position: lsp.Position{Line: 6, Character: 18}, Uri: "test.pory"},
+	}
+	results := ParseReferences(input, "test.pory")
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("Expected:\n%v\n\nGot:\n%v", expected, results)
+	}
+}
+
+func TestReferenceContains(t *testing.T) {
+	ref := Reference{Name: "Foo", Position: lsp.Position{Line: 2, Character: 4}}
+	tests := []struct {
+		position lsp.Position
+		expected bool
+	}{
+		{position: lsp.Position{Line: 2, Character: 3}, expected: false},
+		{position: lsp.Position{Line: 2, Character: 4}, expected: true},
+		{position: lsp.Position{Line: 2, Character: 7}, expected: true},
+		{position: lsp.Position{Line: 2, Character: 8}, expected: false},
+		{position: lsp.Position{Line: 1, Character: 5}, expected: false},
+	}
+	for i, tt := range tests {
+		if result := ref.Contains(tt.position); result != tt.expected {
+			t.Errorf("Test Case %d: Expected: %v, Got: %v", i, tt.expected, result)
+		}
+	}
+}
@@ -2,6 +2,8 @@ package parse
 
 import (
 	"bufio"
+	"fmt"
+	"path"
 	"regexp"
 	"strings"
 
@@ -14,6 +16,30 @@ type Symbol struct {
 	Position lsp.Position
 	Uri      string
 	Kind     SymbolKind
+	// The range of the entire definition, such as a script's keyword
+	// through its closing brace.
+	Range lsp.Range
+	Scope SymbolScope
+	// The name of the symbol that contains this one, such as the script
+	// that a label belongs to. Empty for top-level symbols.
+	Parent string
+}
+
+// SymbolScope is the visibility of a Poryscript symbol in the compiled
+// assembly.
+type SymbolScope int
+
+const (
+	_ SymbolScope = iota
+	SymbolScopeGlobal
+	SymbolScopeLocal
+)
+
+// Returns true if the Symbol can only be referred to from the file it is
+// defined in. This is the case for labels, unless they are global. Labels
+// with an unknown scope are treated as local.
+func (s Symbol) IsFileLocal() bool {
+	return s.Kind == SymbolKindLabel && s.Scope != SymbolScopeGlobal
 }
 
 // SymbolKind is the type of Poryscript symbol.
@@ -49,6 +75,60 @@ func (k SymbolKind) getDetail() string {
 	}
 }
 
+// Gets the Poryscript keyword that declares a SymbolKind.
+func (k SymbolKind) GetKeyword() string {
+	switch k {
+	case SymbolKindScript:
+		return "script"
+	case SymbolKindMapScripts:
+		return "mapscripts"
+	case SymbolKindMovementScript:
+		return "movement"
+	case SymbolKindMart:
+		return "mart"
+	case SymbolKindText:
+		return "text"
+	case SymbolKindLabel:
+		return "label"
+	default:
+		return ""
+	}
+}
+
+// Gets an empty top-level definition of a symbol with the given name and
+// kind, such as 'script Name { }'. Returns an empty string for kinds that
+// can't be defined at the top level.
+func (k SymbolKind) GetStub(name string) string {
+	switch k {
+	case SymbolKindText:
+		return fmt.Sprintf("text %s { \"\" }", name)
+	case SymbolKindScript, SymbolKindMovementScript, SymbolKindMart:
+		return fmt.Sprintf("%s %s { }", k.GetKeyword(), name)
+	default:
+		return ""
+	}
+}
+
+// Gets the LSP SymbolKind for a SymbolKind.
+func (k SymbolKind) GetLSPSymbolKind() lsp.SymbolKind {
+	switch k {
+	case SymbolKindScript:
+		return lsp.SKFunction
+	case SymbolKindMapScripts:
+		return lsp.SKModule
+	case SymbolKindMovementScript:
+		return lsp.SKArray
+	case SymbolKindMart:
+		return lsp.SKStruct
+	case SymbolKindText:
+		return lsp.SKString
+	case SymbolKindLabel:
+		return lsp.SKKey
+	default:
+		return lsp.SKVariable
+	}
+}
+
 // Gets the CompletionItemKind for a SymbolKind.
 func (k SymbolKind) getCompletionItemKind() lsp.CompletionItemKind {
 	switch k {
@@ -84,6 +164,40 @@ func (s Symbol) ToLocation() lsp.Location {
 	}
 }
 
+// Returns the lsp.Hover representation of a Symbol.
+func (s Symbol) ToHover() lsp.Hover {
+	return lsp.Hover{
+		Contents: []lsp.MarkedString{
+			{Language: "poryscript", Value: s.getDeclaration()},
+			lsp.RawMarkedString(fmt.Sprintf("%s defined in `%s`", s.Kind.getDetail(), strings.TrimPrefix(s.Uri, "file://"))),
+		},
+	}
+}
+
+// Gets the Poryscript syntax that declares the Symbol, such as 'script Foo'.
+// Labels have no keyword, so they are declared as 'Foo:'.
+func (s Symbol) getDeclaration() string {
+	if s.Kind != SymbolKindLabel {
+		return fmt.Sprintf("%s %s", s.Kind.GetKeyword(), s.Name)
+	}
+	if s.Scope == SymbolScopeGlobal {
+		return fmt.Sprintf("%s(global):", s.Name)
+	}
+	return fmt.Sprintf("%s:", s.Name)
+}
+
+// Returns the lsp.SymbolInformation representation of a Symbol. The
+// container name is the folder that holds the symbol's file, which is
+// the map name for map scripts.
+func (s Symbol) ToSymbolInformation() lsp.SymbolInformation {
+	return lsp.SymbolInformation{
+		Name:          s.Name,
+		Kind:          s.Kind.GetLSPSymbolKind(),
+		Location:      s.ToLocation(),
+		ContainerName: path.Base(path.Dir(s.Uri)),
+	}
+}
+
 var symbolRegexes = []struct {
 	re   *regexp.Regexp
 	kind SymbolKind
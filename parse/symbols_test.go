@@ -46,3 +46,74 @@ MyLabel:
 		t.Errorf("ParseSymbols with empty string should return an empty array")
 	}
 }
+
+func TestSymbolToHover(t *testing.T) {
+	input := Symbol{Name: "Route101_EventScript_Boy", Uri: "file:///decomp/data/maps/Route101/scripts.pory", Kind: SymbolKindScript}
+	expected := lsp.Hover{Contents: []lsp.MarkedString{
+		{Language: "poryscript", Value: "script Route101_EventScript_Boy"},
+		lsp.RawMarkedString("Script defined in `/decomp/data/maps/Route101/scripts.pory`"),
+	}}
+	result := input.ToHover()
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected:\n%v\n\nGot:\n%v", expected, result)
+	}
+}
+
+func TestLabelSymbolToHover(t *testing.T) {
+	tests := []struct {
+		scope    SymbolScope
+		expected string
+	}{
+		{scope: SymbolScopeLocal, expected: "MyLabel:"},
+		{scope: SymbolScopeGlobal, expected: "MyLabel(global):"},
+	}
+	for i, tt := range tests {
+		input := Symbol{Name: "MyLabel", Uri: "file:///decomp/data/maps/Route101/scripts.pory", Kind: SymbolKindLabel, Scope: tt.scope}
+		expected := lsp.Hover{Contents: []lsp.MarkedString{
+			{Language: "poryscript", Value: tt.expected},
+			lsp.RawMarkedString("Label defined in `/decomp/data/maps/Route101/scripts.pory`"),
+		}}
+		if result := input.ToHover(); !reflect.DeepEqual(result, expected) {
+			t.Errorf("Test Case %d: Expected:\n%v\n\nGot:\n%v", i, expected, result)
+		}
+	}
+}
+
+func TestSymbolToSymbolInformation(t *testing.T) {
+	input := Symbol{Name: "LilycoveCity_Mart", Position: lsp.Position{Line: 3, Character: 4}, Uri: "file:///decomp/data/maps/LilycoveCity_DepartmentStore_2F/scripts.pory", Kind: SymbolKindMart}
+	expected := lsp.SymbolInformation{
+		Name: "LilycoveCity_Mart",
+		Kind: lsp.SKStruct,
+		Location: lsp.Location{
+			URI: "file:///decomp/data/maps/LilycoveCity_DepartmentStore_2F/scripts.pory",
+			Range: lsp.Range{
+				Start: lsp.Position{Line: 3, Character: 4},
+				End:   lsp.Position{Line: 3, Character: 21},
+			},
+		},
+		ContainerName: "LilycoveCity_DepartmentStore_2F",
+	}
+	result := input.ToSymbolInformation()
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("Expected:\n%v\n\nGot:\n%v", expected, result)
+	}
+}
+
+func TestSymbolKindGetStub(t *testing.T) {
+	tests := []struct {
+		kind     SymbolKind
+		expected string
+	}{
+		{kind: SymbolKindText, expected: `text MyName { "" }`},
+		{kind: SymbolKindScript, expected: `script MyName { }`},
+		{kind: SymbolKindMovementScript, expected: `movement MyName { }`},
+		{kind: SymbolKindMart, expected: `mart MyName { }`},
+		{kind: SymbolKindLabel, expected: ""},
+		{kind: SymbolKindMapScripts, expected: ""},
+	}
+	for i, tt := range tests {
+		if result := tt.kind.GetStub("MyName"); result != tt.expected {
+			t.Errorf("Test Case %d: Expected: %v, Got: %v", i, tt.expected, result)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package parse
 
 import (
 	"bufio"
+	"fmt"
 	"regexp"
 	"strings"
 
@@ -18,12 +19,129 @@ type MiscToken struct {
 	Value    string
 }
 
+// MiscTokenCategory is the kind of game value that a MiscToken names.
+type MiscTokenCategory int
+
+const (
+	_ MiscTokenCategory = iota
+	MiscTokenCategoryFlag
+	MiscTokenCategoryVar
+	MiscTokenCategoryTrainer
+	MiscTokenCategoryItem
+)
+
+var miscTokenCategories = []MiscTokenCategory{
+	MiscTokenCategoryFlag,
+	MiscTokenCategoryVar,
+	MiscTokenCategoryTrainer,
+	MiscTokenCategoryItem,
+}
+
+// Gets the display name of a MiscTokenCategory.
+func (c MiscTokenCategory) String() string {
+	switch c {
+	case MiscTokenCategoryFlag:
+		return "flag"
+	case MiscTokenCategoryVar:
+		return "var"
+	case MiscTokenCategoryTrainer:
+		return "trainer"
+	case MiscTokenCategoryItem:
+		return "item"
+	default:
+		return ""
+	}
+}
+
+// Returns true if the MiscToken is a C define. Defines can also be included
+// with a category as their type, such as "flag" or "item".
+func (t MiscToken) IsDefine() bool {
+	return t.Type == "define" || t.typeCategory() != 0
+}
+
+// Gets the category named by the MiscToken's type, if any.
+func (t MiscToken) typeCategory() MiscTokenCategory {
+	for _, category := range miscTokenCategories {
+		if t.Type == category.String() {
+			return category
+		}
+	}
+	return 0
+}
+
+// Gets the category that the MiscToken was explicitly included with. That
+// is either the token's type, or the header file that a define comes from.
+// Returns 0 if the token wasn't explicitly categorized.
+func (t MiscToken) IncludedCategory() MiscTokenCategory {
+	if category := t.typeCategory(); category != 0 {
+		return category
+	}
+	if t.Type != "define" {
+		return 0
+	}
+	switch {
+	case strings.HasSuffix(t.Uri, "/flags.h"):
+		return MiscTokenCategoryFlag
+	case strings.HasSuffix(t.Uri, "/vars.h"):
+		return MiscTokenCategoryVar
+	case strings.HasSuffix(t.Uri, "/opponents.h"):
+		return MiscTokenCategoryTrainer
+	case strings.HasSuffix(t.Uri, "/items.h"):
+		return MiscTokenCategoryItem
+	}
+	return 0
+}
+
+// Gets the category of the MiscToken. The category comes from the token's
+// type, if it names one. Otherwise, defines are categorized by the header
+// file they come from, or by the decomp's naming conventions. Returns 0 if
+// the category is unknown.
+func (t MiscToken) Category() MiscTokenCategory {
+	if category := t.IncludedCategory(); category != 0 {
+		return category
+	}
+	if t.Type != "define" {
+		return 0
+	}
+	switch {
+	case strings.HasPrefix(t.Name, "FLAG_"):
+		return MiscTokenCategoryFlag
+	case strings.HasPrefix(t.Name, "VAR_"):
+		return MiscTokenCategoryVar
+	case strings.HasPrefix(t.Name, "TRAINER_"):
+		return MiscTokenCategoryTrainer
+	case strings.HasPrefix(t.Name, "ITEM_"):
+		return MiscTokenCategoryItem
+	}
+	return 0
+}
+
+// The categories of the arguments for scripting commands that take flags
+// or vars, keyed by command name.
+var CommandArgCategories = map[string][]MiscTokenCategory{
+	"setflag":              {MiscTokenCategoryFlag},
+	"clearflag":            {MiscTokenCategoryFlag},
+	"checkflag":            {MiscTokenCategoryFlag},
+	"goto_if_set":          {MiscTokenCategoryFlag},
+	"goto_if_unset":        {MiscTokenCategoryFlag},
+	"call_if_set":          {MiscTokenCategoryFlag},
+	"call_if_unset":        {MiscTokenCategoryFlag},
+	"setvar":               {MiscTokenCategoryVar},
+	"addvar":               {MiscTokenCategoryVar},
+	"subvar":               {MiscTokenCategoryVar},
+	"copyvar":              {MiscTokenCategoryVar, MiscTokenCategoryVar},
+	"setorcopyvar":         {MiscTokenCategoryVar},
+	"compare":              {MiscTokenCategoryVar},
+	"compare_var_to_var":   {MiscTokenCategoryVar, MiscTokenCategoryVar},
+	"compare_var_to_value": {MiscTokenCategoryVar},
+}
+
 // Gets the CompletionItemKind for the MiscToken's type.
 func (t MiscToken) getCompletionItemKind() lsp.CompletionItemKind {
-	switch t.Type {
-	case "special":
+	switch {
+	case t.Type == "special":
 		return lsp.CIKFunction
-	case "define":
+	case t.IsDefine():
 		return lsp.CIKConstant
 	default:
 		return lsp.CIKValue
@@ -32,10 +150,10 @@ func (t MiscToken) getCompletionItemKind() lsp.CompletionItemKind {
 
 // Gets the CompletionItemKind for the MiscToken's type.
 func (t MiscToken) getDetail() string {
-	switch t.Type {
-	case "special":
+	switch {
+	case t.Type == "special":
 		return "Special Function"
-	case "define":
+	case t.IsDefine():
 		return t.Value
 	default:
 		return ""
@@ -50,6 +168,31 @@ func (t MiscToken) ToCompletionItem() lsp.CompletionItem {
 	}
 }
 
+// Returns the lsp.Hover representation of a MiscToken.
+func (t MiscToken) ToHover() lsp.Hover {
+	switch {
+	case t.IsDefine():
+		return lsp.Hover{
+			Contents: []lsp.MarkedString{
+				{Language: "c", Value: fmt.Sprintf("#define %s %s", t.Name, t.Value)},
+			},
+		}
+	case t.Type == "special":
+		return lsp.Hover{
+			Contents: []lsp.MarkedString{
+				{Language: "poryscript", Value: t.Name},
+				lsp.RawMarkedString(t.getDetail()),
+			},
+		}
+	default:
+		return lsp.Hover{
+			Contents: []lsp.MarkedString{
+				{Language: "poryscript", Value: t.Name},
+			},
+		}
+	}
+}
+
 // Returns the lsp.Location representation of a MiscToken.
 func (t MiscToken) ToLocation() lsp.Location {
 	return lsp.Location{
@@ -86,7 +229,7 @@ func ParseMiscTokens(content string, expression string, tokenType string, fileUr
 				Type:     tokenType,
 				Uri:      fileUri,
 			}
-			if tokenType == "define" && len(match) > 5 {
+			if token.IsDefine() && len(match) > 5 {
 				token.Value = line[match[4]:match[5]]
 			}
 			tokens = append(tokens, token)
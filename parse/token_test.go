@@ -67,6 +67,32 @@ func TestMiscTokenToLocation(t *testing.T) {
 	}
 }
 
+func TestMiscTokenToHover(t *testing.T) {
+	tests := []struct {
+		input    MiscToken
+		expected lsp.Hover
+	}{
+		{
+			input:    MiscToken{Name: "FLAG_BADGE01_GET", Type: "define", Value: "(SYSTEM_FLAGS + 0x7)"},
+			expected: lsp.Hover{Contents: []lsp.MarkedString{{Language: "c", Value: "#define FLAG_BADGE01_GET (SYSTEM_FLAGS + 0x7)"}}},
+		},
+		{
+			input:    MiscToken{Name: "HealPlayerParty", Type: "special"},
+			expected: lsp.Hover{Contents: []lsp.MarkedString{{Language: "poryscript", Value: "HealPlayerParty"}, lsp.RawMarkedString("Special Function")}},
+		},
+		{
+			input:    MiscToken{Name: "Other"},
+			expected: lsp.Hover{Contents: []lsp.MarkedString{{Language: "poryscript", Value: "Other"}}},
+		},
+	}
+	for i, tt := range tests {
+		result := tt.input.ToHover()
+		if !reflect.DeepEqual(result, tt.expected) {
+			t.Errorf("Test Case %d:\nExpected:\n%v\n\nGot:\n%v", i, tt.expected, result)
+		}
+	}
+}
+
 func TestParseMiscTokens(t *testing.T) {
 	tests := []struct {
 		input      string
@@ -123,3 +149,91 @@ def_special DoCableClubWarp`,
 		}
 	}
 }
+
+func TestMiscTokenCategory(t *testing.T) {
+	tests := []struct {
+		input    MiscToken
+		expected MiscTokenCategory
+	}{
+		{
+			input:    MiscToken{Name: "SPECIAL_FOO", Type: "special"},
+			expected: 0,
+		},
+		{
+			input:    MiscToken{Name: "FLAG_HIDE_X", Type: "define", Uri: "file:///include/constants/flags.h"},
+			expected: MiscTokenCategoryFlag,
+		},
+		{
+			input:    MiscToken{Name: "TEMP_1", Type: "define", Uri: "file:///include/constants/vars.h"},
+			expected: MiscTokenCategoryVar,
+		},
+		{
+			input:    MiscToken{Name: "VAR_TEMP_1", Type: "define", Uri: "file:///include/constants/misc.h"},
+			expected: MiscTokenCategoryVar,
+		},
+		{
+			input:    MiscToken{Name: "SPECIES_TREECKO", Type: "define", Uri: "file:///include/constants/species.h"},
+			expected: 0,
+		},
+		{
+			input:    MiscToken{Name: "ITEM_POTION", Type: "define", Uri: "file:///include/constants/items.h"},
+			expected: MiscTokenCategoryItem,
+		},
+		{
+			input:    MiscToken{Name: "TRAINER_BRENDAN", Type: "define", Uri: "file:///include/constants/misc.h"},
+			expected: MiscTokenCategoryTrainer,
+		},
+		{
+			input:    MiscToken{Name: "MY_TRAINER", Type: "trainer"},
+			expected: MiscTokenCategoryTrainer,
+		},
+		{
+			input:    MiscToken{Name: "MY_FLAG", Type: "flag"},
+			expected: MiscTokenCategoryFlag,
+		},
+		{
+			input:    MiscToken{Name: "FLAG_NOT_A_FLAG", Type: "var"},
+			expected: MiscTokenCategoryVar,
+		},
+	}
+	for i, tt := range tests {
+		result := tt.input.Category()
+		if result != tt.expected {
+			t.Errorf("Test Case %d: Expected %v, but got %v", i, tt.expected, result)
+		}
+	}
+}
+
+func TestMiscTokenIncludedCategory(t *testing.T) {
+	tests := []struct {
+		input    MiscToken
+		expected MiscTokenCategory
+	}{
+		{
+			input:    MiscToken{Name: "FLAG_HIDE_X", Type: "define", Uri: "file:///include/constants/flags.h"},
+			expected: MiscTokenCategoryFlag,
+		},
+		{
+			input:    MiscToken{Name: "TEMP_1", Type: "define", Uri: "file:///include/constants/vars.h"},
+			expected: MiscTokenCategoryVar,
+		},
+		{
+			input:    MiscToken{Name: "VAR_TEMP_1", Type: "define", Uri: "file:///include/constants/misc.h"},
+			expected: 0,
+		},
+		{
+			input:    MiscToken{Name: "MY_FLAG", Type: "flag"},
+			expected: MiscTokenCategoryFlag,
+		},
+		{
+			input:    MiscToken{Name: "FLAG_SPECIAL", Type: "special", Uri: "file:///include/constants/flags.h"},
+			expected: 0,
+		},
+	}
+	for i, tt := range tests {
+		result := tt.input.IncludedCategory()
+		if result != tt.expected {
+			t.Errorf("Test Case %d: Expected %v, but got %v", i, tt.expected, result)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package parse
+
+import (
+	"github.com/huderlem/poryscript-pls/lsp"
+	"github.com/huderlem/poryscript/lexer"
+	"github.com/huderlem/poryscript/token"
+)
+
+// Collects all of the tokens in the given Poryscript content.
+func Tokenize(content string) []token.Token {
+	l := lexer.New(content)
+	tokens := []token.Token{}
+	for {
+		t := l.NextToken()
+		if t.Type == token.EOF {
+			break
+		}
+		tokens = append(tokens, t)
+	}
+	return tokens
+}
+
+// Finds the index of the token that starts at the same position as the
+// given token. Returns -1 if there is no such token.
+func FindTokenIndex(tokens []token.Token, t token.Token) int {
+	for i, candidate := range tokens {
+		if candidate.LineNumber == t.LineNumber && candidate.StartUtf8CharIndex == t.StartUtf8CharIndex {
+			return i
+		}
+		if candidate.LineNumber > t.LineNumber {
+			break
+		}
+	}
+	return -1
+}
+
+// Maps the start position of each token to its index in the token list,
+// so that many tokens from the AST can be found without rescanning it.
+type TokenIndex map[tokenPosition]int
+
+type tokenPosition struct {
+	line      int
+	character int
+}
+
+// Builds the index of the given tokens' start positions.
+func NewTokenIndex(tokens []token.Token) TokenIndex {
+	index := make(TokenIndex, len(tokens))
+	for i, t := range tokens {
+		index[tokenPosition{line: t.LineNumber, character: t.StartUtf8CharIndex}] = i
+	}
+	return index
+}
+
+// Finds the index of the token that starts at the same position as the
+// given token. Returns -1 if there is no such token.
+func (index TokenIndex) Find(t token.Token) int {
+	if i, ok := index[tokenPosition{line: t.LineNumber, character: t.StartUtf8CharIndex}]; ok {
+		return i
+	}
+	return -1
+}
+
+// Finds the first '{' at or after the given token index, and returns the
+// index of its matching '}'. Returns -1 if the block is never opened or
+// closed.
+func FindBlockEnd(tokens []token.Token, start int) int {
+	if start < 0 {
+		return -1
+	}
+	i := start
+	for i < len(tokens) && tokens[i].Type != token.LBRACE {
+		i++
+	}
+	depth := 0
+	for ; i < len(tokens); i++ {
+		switch tokens[i].Type {
+		case token.LBRACE:
+			depth++
+		case token.RBRACE:
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// Gets the LSP range spanning from the start of one token to the end of another.
+func TokenSpanToLSPRange(start token.Token, end token.Token) lsp.Range {
+	return lsp.Range{
+		Start: lsp.Position{Line: start.LineNumber - 1, Character: start.StartUtf8CharIndex},
+		End:   lsp.Position{Line: end.EndLineNumber - 1, Character: end.EndUtf8CharIndex},
+	}
+}
@@ -0,0 +1,27 @@
+package parse
+
+import (
+	"testing"
+
+	"github.com/huderlem/poryscript/token"
+)
+
+func TestTokenIndex(t *testing.T) {
+	input := `script MyScript {
+	msgbox("Pokémon", MyText) goto(MyScript)
+}`
+	tokens := Tokenize(input)
+	index := NewTokenIndex(tokens)
+	for i, tok := range tokens {
+		if result := index.Find(tok); result != i {
+			t.Errorf("Test Case %d: Expected index of %q to be %d, Got: %d", i, tok.Literal, i, result)
+		}
+		if result := FindTokenIndex(tokens, tok); result != i {
+			t.Errorf("Test Case %d: FindTokenIndex disagrees for %q, Got: %d", i, tok.Literal, result)
+		}
+	}
+	missing := token.Token{LineNumber: 2, StartUtf8CharIndex: 3}
+	if result := index.Find(missing); result != -1 {
+		t.Errorf("Expected -1 for a position inside a token, Got: %d", result)
+	}
+}
@@ -4,11 +4,45 @@ import (
 	"context"
 	"encoding/json"
 	"net/url"
+	"sort"
 
 	"github.com/huderlem/poryscript-pls/parse"
+	"github.com/huderlem/poryscript/ast"
+	"github.com/huderlem/poryscript/lexer"
 	"github.com/huderlem/poryscript/parser"
 )
 
+// The artifacts that are derived from a file's content are cached along with
+// the revision of the content they were derived from. Document changes only
+// store the new content, so a cached artifact is stale when its revision
+// doesn't match the document's current revision. None of the cache mutexes
+// are held while reading files or fetching settings, since those can wait
+// on the client.
+
+type fileIndexCacheEntry struct {
+	revision  int
+	symbols   []parse.Symbol
+	constants map[string]parse.ConstantSymbol
+}
+
+type referencesCacheEntry struct {
+	revision   int
+	references map[string][]parse.Reference
+}
+
+type programCacheEntry struct {
+	revision int
+	program  *ast.Program
+}
+
+// The same file can be included more than once, with a different expression
+// or token type each time.
+type miscTokensCacheKey struct {
+	file       string
+	expression string
+	tokenType  string
+}
+
 // Gets the aggregate list of Commands from the collection of files that define
 // the Commands. The Commands are cached for the given file uri so that parsing is
 // avoided in future calls.
@@ -39,11 +73,11 @@ func (s *poryscriptServer) getCommands(ctx context.Context, uri string) (map[str
 // are cached for the file so that parsing is avoided in future
 // calls.
 func (s *poryscriptServer) getCommandsInFile(ctx context.Context, uri string) (map[string]parse.Command, error) {
-	s.commandsMutex.Lock()
-	defer s.commandsMutex.Unlock()
-
 	uri, _ = url.QueryUnescape(uri)
-	if commands, ok := s.cachedCommands[uri]; ok {
+	s.commandsMutex.Lock()
+	commands, ok := s.cachedCommands[uri]
+	s.commandsMutex.Unlock()
+	if ok {
 		return commands, nil
 	}
 	return s.getAndCacheCommandsInFile(ctx, uri)
@@ -52,28 +86,27 @@ func (s *poryscriptServer) getCommandsInFile(ctx context.Context, uri string) (m
 // Fetches and caches the Commands from the given file uri.
 func (s *poryscriptServer) getAndCacheCommandsInFile(ctx context.Context, uri string) (map[string]parse.Command, error) {
 	uri, _ = url.QueryUnescape(uri)
-	var content string
-	if err := s.connection.Call(ctx, "poryscript/readfile", uri, &content); err != nil {
+	content, err := s.fs.ReadFile(ctx, uri)
+	if err != nil {
 		return nil, err
 	}
-	if !s.config.HasWorkspaceFolderCapability {
-		return nil, nil
-	}
 	commands := parse.ParseCommands(content)
 	commandSet := map[string]parse.Command{}
 	for _, c := range commands {
 		commandSet[c.Name] = c
 	}
+	s.commandsMutex.Lock()
 	s.cachedCommands[uri] = commandSet
+	s.commandsMutex.Unlock()
 	return commandSet, nil
 }
 
 func (s *poryscriptServer) getAutovarCommands(ctx context.Context, uri string) (parser.CommandConfig, error) {
-	s.commandConfigMutex.Lock()
-	defer s.commandConfigMutex.Unlock()
-
 	uri, _ = url.QueryUnescape(uri)
-	if autovarCommands, ok := s.cachedAutovarCommands[uri]; ok {
+	s.commandConfigMutex.Lock()
+	autovarCommands, ok := s.cachedAutovarCommands[uri]
+	s.commandConfigMutex.Unlock()
+	if ok {
 		return autovarCommands, nil
 	}
 	return s.getAndCacheAutovarCommands(ctx, uri)
@@ -90,13 +123,10 @@ func (s *poryscriptServer) getAndCacheAutovarCommands(ctx context.Context, uri s
 	}
 
 	commandConfigUri, _ := url.QueryUnescape(settings.CommandConfigFilepath)
-	var content string
-	if err := s.connection.Call(ctx, "poryscript/readfile", commandConfigUri, &content); err != nil {
+	content, err := s.fs.ReadFile(ctx, commandConfigUri)
+	if err != nil {
 		return parser.CommandConfig{}, err
 	}
-	if !s.config.HasWorkspaceFolderCapability {
-		return parser.CommandConfig{}, nil
-	}
 
 	var config parser.CommandConfig
 	if err := json.Unmarshal([]byte(content), &config); err != nil {
@@ -109,59 +139,292 @@ func (s *poryscriptServer) getAndCacheAutovarCommands(ctx context.Context, uri s
 // Gets the list of poryscript constants from the given file uri. The constants
 // are cached for the file so that parsing is avoided in future calls.
 func (s *poryscriptServer) getConstantsInFile(ctx context.Context, uri string) (map[string]parse.ConstantSymbol, error) {
-	s.constantsMutex.Lock()
-	defer s.constantsMutex.Unlock()
+	index, err := s.getFileIndex(ctx, uri)
+	if err != nil {
+		return nil, err
+	}
+	return index.constants, nil
+}
 
+// Gets the list of poryscript symbols from the given file uri. The symbols
+// are cached for the file so that parsing is avoided in future calls.
+// Every definition is kept, even if a name is defined more than once.
+func (s *poryscriptServer) getSymbolsInFile(ctx context.Context, uri string) ([]parse.Symbol, error) {
+	index, err := s.getFileIndex(ctx, uri)
+	if err != nil {
+		return nil, err
+	}
+	return index.symbols, nil
+}
+
+// Gets the symbols and constants defined in the given file uri. They are
+// indexed from the file's cached program, which is parsed with the file's
+// command config. If the file can no longer be read, its index is dropped
+// from the cache.
+func (s *poryscriptServer) getFileIndex(ctx context.Context, uri string) (fileIndexCacheEntry, error) {
 	uri, _ = url.QueryUnescape(uri)
-	if constants, ok := s.cachedConstants[uri]; ok {
-		return constants, nil
+	doc, err := s.getDocument(ctx, uri)
+	if err != nil {
+		s.indexesMutex.Lock()
+		delete(s.cachedIndexes, uri)
+		s.indexesMutex.Unlock()
+		return fileIndexCacheEntry{}, err
 	}
-	return s.getAndCacheConstantsInFile(ctx, uri)
+	return s.getDocumentFileIndex(ctx, doc, uri), nil
 }
 
-// Fetches and caches the poryscript constants from the given file uri.
-func (s *poryscriptServer) getAndCacheConstantsInFile(ctx context.Context, uri string) (map[string]parse.ConstantSymbol, error) {
+// Gets the symbols and constants defined in the given snapshot of a document.
+func (s *poryscriptServer) getDocumentFileIndex(ctx context.Context, doc textDocument, uri string) fileIndexCacheEntry {
+	s.indexesMutex.Lock()
+	entry, ok := s.cachedIndexes[uri]
+	s.indexesMutex.Unlock()
+	if ok && entry.revision == doc.revision {
+		return entry
+	}
+	return s.getAndCacheFileIndex(ctx, doc, uri)
+}
+
+// Indexes and caches the symbols and constants from the given document.
+func (s *poryscriptServer) getAndCacheFileIndex(ctx context.Context, doc textDocument, uri string) fileIndexCacheEntry {
+	// A program that fails to parse is nil, so the index falls back to
+	// scanning the content.
+	program, _ := s.getDocumentProgram(ctx, doc, uri)
+	index := parse.IndexFile(program, doc.content, uri)
+	entry := fileIndexCacheEntry{
+		revision:  doc.revision,
+		symbols:   index.Symbols,
+		constants: map[string]parse.ConstantSymbol{},
+	}
+	for _, c := range index.Constants {
+		entry.constants[c.Name] = c
+	}
+	s.indexesMutex.Lock()
+	defer s.indexesMutex.Unlock()
+	// Another request may have already cached a newer revision.
+	if cached, ok := s.cachedIndexes[uri]; !ok || cached.revision < doc.revision {
+		s.cachedIndexes[uri] = entry
+	}
+	return entry
+}
+
+// Gets the poryscript symbols from every file with cached symbols, keyed by
+// file uri. Stale symbols are parsed again from the files' current content.
+func (s *poryscriptServer) getCachedSymbols(ctx context.Context) map[string][]parse.Symbol {
+	s.indexesMutex.Lock()
+	uris := []string{}
+	for uri := range s.cachedIndexes {
+		uris = append(uris, uri)
+	}
+	s.indexesMutex.Unlock()
+
+	symbols := map[string][]parse.Symbol{}
+	for _, uri := range uris {
+		if fileSymbols, err := s.getSymbolsInFile(ctx, uri); err == nil {
+			symbols[uri] = fileSymbols
+		}
+	}
+	return symbols
+}
+
+// Gets the list of identifier references from the given file uri, keyed by
+// name. The references are cached for the file so that parsing is avoided
+// in future calls.
+func (s *poryscriptServer) getReferencesInFile(ctx context.Context, uri string) (map[string][]parse.Reference, error) {
 	uri, _ = url.QueryUnescape(uri)
-	content, err := s.getDocumentContent(ctx, uri)
+	doc, err := s.getDocument(ctx, uri)
 	if err != nil {
 		return nil, err
 	}
-	constants := parse.ParseConstants(content, uri)
-	constantSet := map[string]parse.ConstantSymbol{}
-	for _, c := range constants {
-		constantSet[c.Name] = c
+	s.referencesMutex.Lock()
+	defer s.referencesMutex.Unlock()
+	if entry, ok := s.cachedReferences[uri]; ok && entry.revision == doc.revision {
+		return entry.references, nil
 	}
-	s.cachedConstants[uri] = constantSet
-	return constantSet, nil
+	return s.getAndCacheReferencesInFile(doc, uri), nil
 }
 
-// Gets the list of poryscript symbols from the given file uri. The symbols
-// are cached for the file so that parsing is avoided in future calls.
-func (s *poryscriptServer) getSymbolsInFile(ctx context.Context, uri string) (map[string]parse.Symbol, error) {
-	s.symbolsMutex.Lock()
-	defer s.symbolsMutex.Unlock()
+// Parses and caches the identifier references from the given document.
+func (s *poryscriptServer) getAndCacheReferencesInFile(doc textDocument, uri string) map[string][]parse.Reference {
+	referenceSet := map[string][]parse.Reference{}
+	for _, r := range parse.ParseReferences(doc.content, uri) {
+		referenceSet[r.Name] = append(referenceSet[r.Name], r)
+	}
+	s.cachedReferences[uri] = referencesCacheEntry{revision: doc.revision, references: referenceSet}
+	return referenceSet
+}
 
+// Records the given file uri as a Poryscript file in the workspace.
+func (s *poryscriptServer) addPoryscriptFile(uri string) {
+	s.poryscriptFilesMutex.Lock()
+	defer s.poryscriptFilesMutex.Unlock()
 	uri, _ = url.QueryUnescape(uri)
-	if symbols, ok := s.cachedSymbols[uri]; ok {
-		return symbols, nil
+	s.poryscriptFiles[uri] = true
+}
+
+// Gets the sorted list of Poryscript file uris known to the server.
+func (s *poryscriptServer) getPoryscriptFiles() []string {
+	s.poryscriptFilesMutex.Lock()
+	defer s.poryscriptFilesMutex.Unlock()
+	uris := []string{}
+	for uri := range s.poryscriptFiles {
+		uris = append(uris, uri)
 	}
-	return s.getAndCacheSymbolsInFile(ctx, uri)
+	sort.Strings(uris)
+	return uris
 }
 
-// Fetches and caches the poryscript symbols from the given file uri.
-func (s *poryscriptServer) getAndCacheSymbolsInFile(ctx context.Context, uri string) (map[string]parse.Symbol, error) {
+// Gets the parsed Poryscript program for the given file uri. Successfully-parsed
+// programs are cached for the file so that parsing is avoided in future calls.
+func (s *poryscriptServer) getProgram(ctx context.Context, uri string) (*ast.Program, error) {
 	uri, _ = url.QueryUnescape(uri)
-	content, err := s.getDocumentContent(ctx, uri)
+	doc, err := s.getDocument(ctx, uri)
+	if err != nil {
+		return nil, err
+	}
+	return s.getDocumentProgram(ctx, doc, uri)
+}
+
+// Gets the parsed Poryscript program for the given snapshot of a document.
+func (s *poryscriptServer) getDocumentProgram(ctx context.Context, doc textDocument, uri string) (*ast.Program, error) {
+	s.programsMutex.Lock()
+	entry, ok := s.cachedPrograms[uri]
+	s.programsMutex.Unlock()
+	if ok && entry.revision == doc.revision {
+		return entry.program, nil
+	}
+	return s.getAndCacheProgram(ctx, doc, uri)
+}
+
+// Parses and caches the Poryscript program from the given document.
+func (s *poryscriptServer) getAndCacheProgram(ctx context.Context, doc textDocument, uri string) (*ast.Program, error) {
+	// TODO: should this potential error be ignored?
+	commandConfig, _ := s.getAutovarCommands(ctx, uri)
+
+	settings, _ := s.config.GetFileSettings(ctx, s.connection, uri)
+	fontConfigFilepath := settings.FontConfigFilepath
+
+	p := parser.NewLintParser(lexer.New(doc.content), commandConfig, fontConfigFilepath, "", 0)
+	program, err := p.ParseProgram()
 	if err != nil {
 		return nil, err
 	}
-	symbols := parse.ParseSymbols(content, uri)
-	symbolSet := map[string]parse.Symbol{}
-	for _, s := range symbols {
-		symbolSet[s.Name] = s
+	s.programsMutex.Lock()
+	defer s.programsMutex.Unlock()
+	// Another request may have already cached a newer revision.
+	if entry, ok := s.cachedPrograms[uri]; !ok || entry.revision < doc.revision {
+		s.cachedPrograms[uri] = programCacheEntry{revision: doc.revision, program: program}
+	}
+	return program, nil
+}
+
+// Returns true if the given symbol can be referred to from the given file
+// uri. Labels are local to the file they are defined in, unless they are
+// global.
+func isSymbolVisibleFrom(symbol parse.Symbol, uri string) bool {
+	return !symbol.IsFileLocal() || symbol.Uri == uri
+}
+
+// Gets the aggregate set of poryscript symbols from every cached file that
+// are visible from the given file uri, keyed by symbol name. If a name is
+// defined more than once, the definition in the given file is preferred.
+// The symbols for the given file uri are loaded first, if they aren't
+// already cached.
+func (s *poryscriptServer) getAllSymbols(ctx context.Context, uri string) map[string]parse.Symbol {
+	uri, _ = url.QueryUnescape(uri)
+	s.getSymbolsInFile(ctx, uri)
+	cachedSymbols := s.getCachedSymbols(ctx)
+	symbols := map[string]parse.Symbol{}
+	for fileUri, fileSymbols := range cachedSymbols {
+		if fileUri == uri {
+			continue
+		}
+		for _, symbol := range fileSymbols {
+			if isSymbolVisibleFrom(symbol, uri) {
+				symbols[symbol.Name] = symbol
+			}
+		}
+	}
+	for _, symbol := range cachedSymbols[uri] {
+		symbols[symbol.Name] = symbol
+	}
+	return symbols
+}
+
+// Gets every definition of the named poryscript symbol, from every cached
+// file, that is visible from the given file uri. The definitions are sorted
+// by location. The symbols for the given file uri are loaded first, if they
+// aren't already cached.
+func (s *poryscriptServer) getSymbolDefinitions(ctx context.Context, uri string, name string) []parse.Symbol {
+	uri, _ = url.QueryUnescape(uri)
+	s.getSymbolsInFile(ctx, uri)
+	definitions := []parse.Symbol{}
+	for _, fileSymbols := range s.getCachedSymbols(ctx) {
+		for _, symbol := range fileSymbols {
+			if symbol.Name == name && isSymbolVisibleFrom(symbol, uri) {
+				definitions = append(definitions, symbol)
+			}
+		}
+	}
+	sortSymbols(definitions)
+	return definitions
+}
+
+// Gets every definition from every cached file, keyed by symbol name.
+func (s *poryscriptServer) getSymbolIndex(ctx context.Context) map[string][]parse.Symbol {
+	index := map[string][]parse.Symbol{}
+	for _, fileSymbols := range s.getCachedSymbols(ctx) {
+		for _, symbol := range fileSymbols {
+			index[symbol.Name] = append(index[symbol.Name], symbol)
+		}
+	}
+	for _, definitions := range index {
+		sortSymbols(definitions)
+	}
+	return index
+}
+
+// workspaceIndex holds the workspace-wide lookups that the diagnostics for
+// every file need. It's built once per validation pass, rather than once per
+// file.
+type workspaceIndex struct {
+	// Every symbol definition, keyed by name.
+	symbols map[string][]parse.Symbol
+	// The reference counts across every Poryscript file. They're only
+	// counted once a check needs them.
+	references      map[string]int
+	countReferences func() map[string]int
+}
+
+// Builds the workspace index from the currently known Poryscript files.
+func (s *poryscriptServer) newWorkspaceIndex(ctx context.Context) *workspaceIndex {
+	return &workspaceIndex{
+		symbols: s.getSymbolIndex(ctx),
+		countReferences: func() map[string]int {
+			return s.getReferenceCounts(ctx, s.getPoryscriptFiles())
+		},
 	}
-	s.cachedSymbols[uri] = symbolSet
-	return symbolSet, nil
+}
+
+// Gets the number of references to each name across every Poryscript file.
+func (w *workspaceIndex) referenceCounts() map[string]int {
+	if w.references == nil {
+		w.references = w.countReferences()
+	}
+	return w.references
+}
+
+// Sorts the symbols by their locations.
+func sortSymbols(symbols []parse.Symbol) {
+	sort.SliceStable(symbols, func(i, j int) bool {
+		a, b := symbols[i], symbols[j]
+		if a.Uri != b.Uri {
+			return a.Uri < b.Uri
+		}
+		if a.Position.Line != b.Position.Line {
+			return a.Position.Line < b.Position.Line
+		}
+		return a.Position.Character < b.Position.Character
+	})
 }
 
 // Gets the aggregate list of miscellaneous tokens from the collection of files
@@ -174,9 +437,7 @@ func (s *poryscriptServer) getMiscTokens(ctx context.Context, uri string) (map[s
 	}
 	miscTokens := map[string]parse.MiscToken{}
 	for _, includeSetting := range settings.SymbolIncludes {
-		s.miscTokensMutex.Lock()
 		tokens, err := s.getMiscTokensInFile(ctx, includeSetting.Expression, includeSetting.Type, includeSetting.File)
-		s.miscTokensMutex.Unlock()
 		if err != nil {
 			// TODO: log error?
 			continue
@@ -192,7 +453,10 @@ func (s *poryscriptServer) getMiscTokens(ctx context.Context, uri string) (map[s
 // are cached for the file so that parsing is avoided in future calls.
 func (s *poryscriptServer) getMiscTokensInFile(ctx context.Context, expression, tokenType, uri string) (map[string]parse.MiscToken, error) {
 	uri, _ = url.QueryUnescape(uri)
-	if tokens, ok := s.cachedMiscTokens[uri+expression]; ok {
+	s.miscTokensMutex.Lock()
+	tokens, ok := s.cachedMiscTokens[miscTokensCacheKey{file: uri, expression: expression, tokenType: tokenType}]
+	s.miscTokensMutex.Unlock()
+	if ok {
 		return tokens, nil
 	}
 	return s.getAndCacheMiscTokensInFile(ctx, expression, tokenType, uri)
@@ -201,12 +465,12 @@ func (s *poryscriptServer) getMiscTokensInFile(ctx context.Context, expression,
 // Fetches and caches the miscellaneous tokens from the given file uri.
 func (s *poryscriptServer) getAndCacheMiscTokensInFile(ctx context.Context, expression, tokenType, uri string) (map[string]parse.MiscToken, error) {
 	uri, _ = url.QueryUnescape(uri)
-	var content string
-	if err := s.connection.Call(ctx, "poryscript/readfile", uri, &content); err != nil {
+	content, err := s.fs.ReadFile(ctx, uri)
+	if err != nil {
 		return nil, err
 	}
-	var fileUri string
-	if err := s.connection.Call(ctx, "poryscript/getfileuri", uri, &fileUri); err != nil {
+	fileUri, err := s.fs.FileURI(ctx, uri)
+	if err != nil {
 		return nil, err
 	}
 	tokens := parse.ParseMiscTokens(content, expression, tokenType, fileUri)
@@ -214,53 +478,61 @@ func (s *poryscriptServer) getAndCacheMiscTokensInFile(ctx context.Context, expr
 	for _, t := range tokens {
 		tokenSet[t.Name] = t
 	}
-	s.cachedMiscTokens[uri+expression] = tokenSet
+	s.miscTokensMutex.Lock()
+	s.cachedMiscTokens[miscTokensCacheKey{file: uri, expression: expression, tokenType: tokenType}] = tokenSet
+	s.miscTokensMutex.Unlock()
 	return tokenSet, nil
 }
 
 // Gets the content for the given file uri. The content is cached
 // for the file so that parsing is avoided in future calls.
 func (s *poryscriptServer) getDocumentContent(ctx context.Context, uri string) (string, error) {
-	s.documentsMutex.Lock()
-	defer s.documentsMutex.Unlock()
+	doc, err := s.getDocument(ctx, uri)
+	if err != nil {
+		return "", err
+	}
+	return doc.content, nil
+}
 
+// Gets the current snapshot of the given file uri's content. Documents that
+// aren't open in the client are read from disk and cached.
+func (s *poryscriptServer) getDocument(ctx context.Context, uri string) (textDocument, error) {
 	uri, _ = url.QueryUnescape(uri)
-	if content, ok := s.cachedDocuments[uri]; ok {
-		return content, nil
+	s.documentsMutex.Lock()
+	doc, ok := s.cachedDocuments[uri]
+	s.documentsMutex.Unlock()
+	if ok {
+		return doc, nil
 	}
-	return s.getAndCacheDocumentContent(ctx, uri)
+	return s.getAndCacheDocument(ctx, uri)
 }
 
 // Fetches and caches the content for the given file uri.
-func (s *poryscriptServer) getAndCacheDocumentContent(ctx context.Context, uri string) (string, error) {
-	uri, _ = url.QueryUnescape(uri)
-	var content string
-	if err := s.connection.Call(ctx, "poryscript/readfs", uri, &content); err != nil {
-		return "", err
+func (s *poryscriptServer) getAndCacheDocument(ctx context.Context, uri string) (textDocument, error) {
+	content, err := s.fs.ReadDocument(ctx, uri)
+	if err != nil {
+		return textDocument{}, err
+	}
+	s.documentsMutex.Lock()
+	defer s.documentsMutex.Unlock()
+	// The document may have been opened, or read by another request, while
+	// its content was being read.
+	if doc, ok := s.cachedDocuments[uri]; ok {
+		return doc, nil
 	}
-	s.cachedDocuments[uri] = content
-	return content, nil
+	return s.storeDocument(uri, textDocument{content: content}), nil
 }
 
-// Clears the various cached artifacts for the given file uri.
+// Clears the cached content for the given file uri, so that it's read
+// from disk again. The content of documents that are open in the client
+// is kept. The artifacts derived from the old content become stale once
+// the content is read again.
 func (s *poryscriptServer) clearCaches(uri string) {
-	s.commandsMutex.Lock()
-	defer s.commandsMutex.Unlock()
-	s.constantsMutex.Lock()
-	defer s.constantsMutex.Unlock()
-	s.symbolsMutex.Lock()
-	defer s.symbolsMutex.Unlock()
-	s.miscTokensMutex.Lock()
-	defer s.miscTokensMutex.Unlock()
-	// The documents mutex lock must be acquired last, in order
-	// to avoid race conditions when loading the symbols and commands.
 	s.documentsMutex.Lock()
 	defer s.documentsMutex.Unlock()
-	delete(s.cachedCommands, uri)
-	delete(s.cachedConstants, uri)
-	delete(s.cachedSymbols, uri)
-	delete(s.cachedMiscTokens, uri)
-	delete(s.cachedDocuments, uri)
+	if !s.cachedDocuments[uri].open {
+		delete(s.cachedDocuments, uri)
+	}
 }
 
 // Clears the various cached artifacts for watched files (.inc and .h files).
@@ -270,5 +542,5 @@ func (s *poryscriptServer) clearWatchedFileCaches() {
 	s.miscTokensMutex.Lock()
 	defer s.miscTokensMutex.Unlock()
 	s.cachedCommands = map[string]map[string]parse.Command{}
-	s.cachedMiscTokens = map[string]map[string]parse.MiscToken{}
+	s.cachedMiscTokens = map[miscTokensCacheKey]map[string]parse.MiscToken{}
 }
@@ -0,0 +1,26 @@
+package server
+
+import (
+	"context"
+	"testing"
+)
+
+func TestGetMiscTokensInFileCachesEachType(t *testing.T) {
+	s, _ := newTestServer(t, map[string]string{
+		"include/constants/flags.h": "#define FLAG_FOO 0x1\n",
+	})
+	ctx := context.Background()
+	expression := `^\s*#define\s+(FLAG_\w+)\s+(.+)`
+	for i, tokenType := range []string{"define", "flag", "define"} {
+		tokens, err := s.getMiscTokensInFile(ctx, expression, tokenType, "include/constants/flags.h")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token, ok := tokens["FLAG_FOO"]; !ok || token.Type != tokenType {
+			t.Errorf("Test Case %d: Expected FLAG_FOO with type %s, Got: %v", i, tokenType, tokens)
+		}
+	}
+	if len(s.cachedMiscTokens) != 2 {
+		t.Errorf("Expected 2 cached token sets, Got: %d", len(s.cachedMiscTokens))
+	}
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/huderlem/poryscript-pls/config"
+	"github.com/huderlem/poryscript-pls/lsp"
+)
+
+// CheckResult holds the diagnostics for a single Poryscript file.
+type CheckResult struct {
+	// Path of the file, relative to the checked directory.
+	Path        string
+	Diagnostics []lsp.Diagnostic
+}
+
+// Check runs the same diagnostics that the language server publishes over
+// every Poryscript file in the given directory, without a client. The
+// include paths in the settings are relative to the directory.
+func Check(ctx context.Context, dir string, settings config.PoryscriptSettings) ([]CheckResult, error) {
+	root, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(root); err != nil {
+		return nil, err
+	} else if !info.IsDir() {
+		return nil, fmt.Errorf("'%s' is not a directory", dir)
+	}
+
+	s := newPoryscriptServer()
+	s.config.DefaultSettings = settings
+	s.fs = diskFileSystem{roots: []string{root}}
+	fileUris, err := s.fs.PoryscriptFiles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	// Index every file first, so that checks which look at symbols
+	// from other files see the whole workspace.
+	for _, fileUri := range fileUris {
+		s.addPoryscriptFile(fileUri)
+		s.getSymbolsInFile(ctx, fileUri)
+	}
+	workspace := s.newWorkspaceIndex(ctx)
+
+	results := []CheckResult{}
+	for _, fileUri := range fileUris {
+		path, err := uriToPath(fileUri)
+		if err != nil {
+			return nil, err
+		}
+		if relPath, err := filepath.Rel(root, path); err == nil {
+			path = relPath
+		}
+		diagnostics, _, err := s.getFileDiagnostics(ctx, fileUri, workspace)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check '%s': %s", path, err)
+		}
+		results = append(results, CheckResult{Path: path, Diagnostics: diagnostics})
+	}
+	return results, nil
+}
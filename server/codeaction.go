@@ -3,10 +3,12 @@ package server
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"net/url"
+	"strings"
 
 	"github.com/huderlem/poryscript-pls/lsp"
-	"github.com/huderlem/poryscript/lexer"
+	"github.com/huderlem/poryscript-pls/parse"
 	"github.com/huderlem/poryscript/refactor"
 	"github.com/huderlem/poryscript/token"
 )
@@ -31,6 +33,9 @@ type codeActionData struct {
 	Character   int    `json:"character"`
 	TargetStyle int    `json:"targetStyle"`
 	ConvertAll  bool   `json:"convertAll,omitempty"`
+	// The name and kind of an undefined symbol to create a stub for.
+	StubName string `json:"stubName,omitempty"`
+	StubKind int    `json:"stubKind,omitempty"`
 }
 
 // onCodeAction handles the textDocument/codeAction request.
@@ -43,31 +48,23 @@ func (s *poryscriptServer) onCodeAction(ctx context.Context, req lsp.CodeActionP
 		return nil, err
 	}
 
-	// Tokenize the document.
-	l := lexer.New(content)
-	var tokens []token.Token
-	for {
-		t := l.NextToken()
-		if t.Type == token.EOF {
-			break
-		}
-		tokens = append(tokens, t)
-	}
+	tokens := parse.Tokenize(content)
+
+	actions := s.getCreateSymbolActions(ctx, req, content)
 
 	// Find a string token at the cursor position, ignoring format() strings.
 	tok, tokIdx, found := refactor.FindStringTokenAtPosition(tokens, req.Range.Start.Line, req.Range.Start.Character)
 	if !found || refactor.IsFormatStringToken(tokens, tokIdx) {
-		return nil, nil
+		return actions, nil
 	}
 
 	// Extract source text and detect current style.
 	sourceText := refactor.ExtractTokenSourceText(content, tok)
 	if sourceText == "" {
-		return nil, nil
+		return actions, nil
 	}
 	currentStyle := refactor.DetectStringStyle(sourceText)
 
-	var actions []lsp.CodeAction
 	allStyles := []refactor.StringStyle{refactor.StyleAuto, refactor.StyleConcatenated, refactor.StyleSingleLine}
 
 	// Per-string conversion actions (excluding the current style).
@@ -126,17 +123,12 @@ func (s *poryscriptServer) onCodeActionResolve(ctx context.Context, action lsp.C
 		return action, err
 	}
 
-	// Tokenize the document.
-	l := lexer.New(content)
-	var tokens []token.Token
-	for {
-		t := l.NextToken()
-		if t.Type == token.EOF {
-			break
-		}
-		tokens = append(tokens, t)
+	if len(data.StubName) > 0 {
+		return resolveCreateSymbol(action, data, content)
 	}
 
+	tokens := parse.Tokenize(content)
+
 	targetStyle := refactor.StringStyle(data.TargetStyle)
 
 	if data.ConvertAll {
@@ -145,6 +137,79 @@ func (s *poryscriptServer) onCodeActionResolve(ctx context.Context, action lsp.C
 	return resolveConvertSingle(action, data, content, tokens, targetStyle)
 }
 
+// getCreateSymbolActions gets the quick fixes that create a stub for each
+// undefined symbol in the request's diagnostics. The kind of the stub comes
+// from the parameter of the command that the symbol is passed to.
+func (s *poryscriptServer) getCreateSymbolActions(ctx context.Context, req lsp.CodeActionParams, content string) []lsp.CodeAction {
+	var actions []lsp.CodeAction
+	commands, _ := s.getCommands(ctx, string(req.TextDocument.URI))
+	seen := map[string]bool{}
+	for _, d := range req.Context.Diagnostics {
+		if d.Code != "warning-undefinedSymbol" {
+			continue
+		}
+		name := parse.GetTokenAt(content, d.Range.Start.Line, d.Range.Start.Character)
+		callInfo, err := parse.GetCommandCallParts(content, d.Range.Start.Line, d.Range.Start.Character)
+		if len(name) == 0 || err != nil || seen[name] {
+			continue
+		}
+		command, ok := commands[callInfo.Command]
+		argIndex := callInfo.GetArgIndex(d.Range.Start)
+		if !ok || argIndex >= len(command.Parameters) {
+			continue
+		}
+		kind := command.Parameters[argIndex].ExpectedSymbolKind()
+		if len(kind.GetStub(name)) == 0 {
+			continue
+		}
+		data, err := json.Marshal(codeActionData{
+			URI:       string(req.TextDocument.URI),
+			Line:      d.Range.Start.Line,
+			Character: d.Range.Start.Character,
+			StubName:  name,
+			StubKind:  int(kind),
+		})
+		if err != nil {
+			continue
+		}
+		seen[name] = true
+		actions = append(actions, lsp.CodeAction{
+			Title:       fmt.Sprintf("Create %s \"%s\"", kind.GetKeyword(), name),
+			Kind:        lsp.CAKQuickFix,
+			Diagnostics: []lsp.Diagnostic{d},
+			IsPreferred: true,
+			Data:        data,
+		})
+	}
+	return actions
+}
+
+// resolveCreateSymbol computes the edit that appends a symbol's stub to the
+// end of the file.
+func resolveCreateSymbol(action lsp.CodeAction, data codeActionData, content string) (lsp.CodeAction, error) {
+	stub := parse.SymbolKind(data.StubKind).GetStub(data.StubName)
+	if len(stub) == 0 {
+		return action, nil
+	}
+	newText := "\n" + stub + "\n"
+	if len(content) > 0 && !strings.HasSuffix(content, "\n") {
+		newText = "\n" + newText
+	}
+	lines := strings.Split(content, "\n")
+	end := getLinesRange(lines, len(lines)-1, len(lines)-1).End
+	action.Edit = &lsp.WorkspaceEdit{
+		Changes: map[string][]lsp.TextEdit{
+			data.URI: {
+				{
+					Range:   lsp.Range{Start: end, End: end},
+					NewText: newText,
+				},
+			},
+		},
+	}
+	return action, nil
+}
+
 // resolveConvertSingle computes the edit for a single string conversion.
 func resolveConvertSingle(action lsp.CodeAction, data codeActionData, content string, tokens []token.Token, targetStyle refactor.StringStyle) (lsp.CodeAction, error) {
 	tok, tokIdx, found := refactor.FindStringTokenAtPosition(tokens, data.Line, data.Character)
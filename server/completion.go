@@ -0,0 +1,274 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"github.com/huderlem/poryscript-pls/lsp"
+	"github.com/huderlem/poryscript-pls/parse"
+)
+
+// The maximum number of lines shown when previewing a symbol's definition.
+const maxDefinitionPreviewLines = 12
+
+// The maximum number of items returned from a completion request. If more
+// items match, the list is marked as incomplete, so that the client asks
+// again as the user keeps typing.
+const maxCompletionItems = 200
+
+// completionItemSource is the kind of entity that a completion item was
+// created from.
+type completionItemSource int
+
+const (
+	_ completionItemSource = iota
+	completionSourceCommand
+	completionSourceConstant
+	completionSourceSymbol
+	completionSourceMiscToken
+)
+
+// completionItemData is the payload stored in CompletionItem.Data so that
+// completionItem/resolve can look up the item's entity again. The entity's
+// name is the item's label. The URI is the document's uri as it was sent by
+// the client.
+type completionItemData struct {
+	URI    string               `json:"uri"`
+	Source completionItemSource `json:"source"`
+}
+
+// completionItemBuilder collects the completion items for a single request.
+// Items are sent without their detail and documentation, which are filled
+// in by completionItem/resolve, since requests can have thousands of items.
+type completionItemBuilder struct {
+	uri   string
+	items []lsp.CompletionItem
+	// Whether the client can insert snippets. Otherwise, items only
+	// insert their labels.
+	snippetSupport bool
+}
+
+func (b *completionItemBuilder) add(item lsp.CompletionItem, source completionItemSource) {
+	item.Detail = ""
+	item.Documentation = ""
+	if !b.snippetSupport && item.InsertTextFormat == lsp.ITFSnippet {
+		item.InsertText = ""
+		item.InsertTextFormat = 0
+	}
+	item.Data = completionItemData{URI: b.uri, Source: source}
+	b.items = append(b.items, item)
+}
+
+func (b *completionItemBuilder) addCommand(command parse.Command) {
+	b.add(command.ToCompletionItem(), completionSourceCommand)
+}
+
+func (b *completionItemBuilder) addConstants(constants map[string]parse.ConstantSymbol) {
+	for _, constant := range constants {
+		b.add(constant.ToCompletionItem(), completionSourceConstant)
+	}
+}
+
+func (b *completionItemBuilder) addSymbol(symbol parse.Symbol) {
+	b.add(symbol.ToCompletionItem(), completionSourceSymbol)
+}
+
+func (b *completionItemBuilder) addMiscToken(miscToken parse.MiscToken) {
+	b.add(miscToken.ToCompletionItem(), completionSourceMiscToken)
+}
+
+// Handles an incoming LSP 'textDocument/completion' request.
+// https://microsoft.github.io/language-server-protocol/specifications/specification-current/#textDocument_completion
+func (s *poryscriptServer) onCompletion(ctx context.Context, req lsp.CompletionParams) (lsp.CompletionList, error) {
+	// The cache getters unescape the uri, so the client's uri is passed to
+	// them as-is, and it's also the uri that resolving the items uses.
+	uri := string(req.TextDocument.URI)
+	content, err := s.getDocumentContent(ctx, uri)
+	if err != nil {
+		return lsp.CompletionList{Items: []lsp.CompletionItem{}}, err
+	}
+	completionContext := parse.GetCompletionContext(content, req.Position)
+	commands, _ := s.getCommands(ctx, uri)
+	constants, _ := s.getConstantsInFile(ctx, uri)
+	miscTokens, _ := s.getMiscTokens(ctx, uri)
+	symbols := s.getAllSymbols(ctx, uri)
+
+	b := &completionItemBuilder{uri: uri, items: []lsp.CompletionItem{}, snippetSupport: s.config.HasSnippetCapability}
+	switch completionContext.Kind {
+	case parse.CompletionContextTopLevel:
+		for _, command := range parse.KeywordCommands {
+			if command.IsTopLevelKeyword() {
+				b.addCommand(command)
+			}
+		}
+	case parse.CompletionContextMovement:
+		for _, command := range commands {
+			if command.Kind == parse.CommandMovement {
+				b.addCommand(command)
+			}
+		}
+	case parse.CompletionContextMart:
+		addCategoryCompletionItems(b, miscTokens, constants, parse.MiscTokenCategoryItem)
+	case parse.CompletionContextText:
+		if command, ok := commands["format"]; ok {
+			b.addCommand(command)
+		}
+	case parse.CompletionContextCondition:
+		addCategoryCompletionItems(b, miscTokens, constants, completionContext.Category)
+	case parse.CompletionContextCommandArg:
+		addCommandArgCompletionItems(b, completionContext, commands, constants, miscTokens, symbols)
+	case parse.CompletionContextScript:
+		for _, command := range commands {
+			if command.Kind != parse.CommandMovement && !command.IsTopLevelKeyword() {
+				b.addCommand(command)
+			}
+		}
+		b.addConstants(constants)
+		for _, symbol := range symbols {
+			b.addSymbol(symbol)
+		}
+		for _, miscToken := range miscTokens {
+			b.addMiscToken(miscToken)
+		}
+	}
+	prefix := parse.GetTokenPrefixAt(content, req.Position.Line, req.Position.Character)
+	return rankCompletionItems(b.items, prefix, maxCompletionItems), nil
+}
+
+// Filters the completion items to those that fuzzy-match the typed prefix,
+// and sorts them from best to worst match. At most limit items are kept.
+// The items' sort text preserves the ranking in the client.
+func rankCompletionItems(items []lsp.CompletionItem, prefix string, limit int) lsp.CompletionList {
+	type match struct {
+		item  lsp.CompletionItem
+		score int
+	}
+	matches := []match{}
+	for _, item := range items {
+		if score, ok := parse.FuzzyMatch(prefix, item.Label); ok {
+			matches = append(matches, match{item: item, score: score})
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if a.score != b.score {
+			return a.score > b.score
+		}
+		if len(a.item.Label) != len(b.item.Label) {
+			return len(a.item.Label) < len(b.item.Label)
+		}
+		if a.item.Label != b.item.Label {
+			return a.item.Label < b.item.Label
+		}
+		return a.item.Kind < b.item.Kind
+	})
+
+	list := lsp.CompletionList{Items: []lsp.CompletionItem{}}
+	if len(matches) > limit {
+		matches = matches[:limit]
+		list.IsIncomplete = true
+	}
+	for i, m := range matches {
+		m.item.SortText = fmt.Sprintf("%04d", i)
+		list.Items = append(list.Items, m.item)
+	}
+	return list
+}
+
+// Adds the completion items for the argument of a command call. Arguments
+// that expect a flag, var, or Poryscript symbol only complete to those.
+func addCommandArgCompletionItems(b *completionItemBuilder, completionContext parse.CompletionContext, commands map[string]parse.Command, constants map[string]parse.ConstantSymbol, miscTokens map[string]parse.MiscToken, symbols map[string]parse.Symbol) {
+	if categories, ok := parse.CommandArgCategories[completionContext.Command]; ok && completionContext.ArgIndex < len(categories) {
+		addCategoryCompletionItems(b, miscTokens, constants, categories[completionContext.ArgIndex])
+		return
+	}
+	if command, ok := commands[completionContext.Command]; ok && completionContext.ArgIndex < len(command.Parameters) {
+		if kind := command.Parameters[completionContext.ArgIndex].ExpectedSymbolKind(); kind != 0 {
+			for _, symbol := range symbols {
+				// Labels can be jumped to, just like scripts.
+				if symbol.Kind == kind || (kind == parse.SymbolKindScript && symbol.Kind == parse.SymbolKindLabel) {
+					b.addSymbol(symbol)
+				}
+			}
+			return
+		}
+	}
+	b.addConstants(constants)
+	for _, symbol := range symbols {
+		b.addSymbol(symbol)
+	}
+	for _, miscToken := range miscTokens {
+		b.addMiscToken(miscToken)
+	}
+}
+
+// Adds the completion items for the included defines in the given category,
+// along with the file's constants, which may be aliases for them. If no
+// defines are known to be in the category, every define is offered instead.
+func addCategoryCompletionItems(b *completionItemBuilder, miscTokens map[string]parse.MiscToken, constants map[string]parse.ConstantSymbol, category parse.MiscTokenCategory) {
+	found := false
+	for _, miscToken := range miscTokens {
+		if miscToken.Category() == category {
+			b.addMiscToken(miscToken)
+			found = true
+		}
+	}
+	if !found {
+		for _, miscToken := range miscTokens {
+			if miscToken.IsDefine() {
+				b.addMiscToken(miscToken)
+			}
+		}
+	}
+	b.addConstants(constants)
+}
+
+// Handles an incoming LSP 'completionItem/resolve' request.
+// https://microsoft.github.io/language-server-protocol/specifications/specification-current/#completionItem_resolve
+func (s *poryscriptServer) onCompletionItemResolve(ctx context.Context, item lsp.CompletionItem) (lsp.CompletionItem, error) {
+	// The data was decoded as a generic JSON value, so round-trip it.
+	rawData, err := json.Marshal(item.Data)
+	if err != nil {
+		return item, err
+	}
+	var data completionItemData
+	if err := json.Unmarshal(rawData, &data); err != nil {
+		return item, err
+	}
+
+	switch data.Source {
+	case completionSourceCommand:
+		commands, _ := s.getCommands(ctx, data.URI)
+		if command, ok := commands[item.Label]; ok {
+			full := command.ToCompletionItem()
+			item.Detail = full.Detail
+			item.Documentation = full.Documentation
+			if command.Kind == parse.CommandScriptMacro && len(command.Parameters) > 0 {
+				item.Detail = command.GetParamsLabel()
+			}
+		}
+	case completionSourceConstant:
+		constants, _ := s.getConstantsInFile(ctx, data.URI)
+		if constant, ok := constants[item.Label]; ok {
+			item.Detail = fmt.Sprintf("const %s = %s", constant.Name, constant.Value)
+		}
+	case completionSourceSymbol:
+		if symbol, ok := s.getAllSymbols(ctx, data.URI)[item.Label]; ok {
+			item.Detail = symbol.ToCompletionItem().Detail
+			if content, err := s.getDocumentContent(ctx, symbol.Uri); err == nil {
+				item.Documentation = parse.GetRangePreview(content, symbol.Range, maxDefinitionPreviewLines)
+			}
+		}
+	case completionSourceMiscToken:
+		miscTokens, _ := s.getMiscTokens(ctx, data.URI)
+		if miscToken, ok := miscTokens[item.Label]; ok {
+			item.Detail = miscToken.ToCompletionItem().Detail
+			if miscToken.IsDefine() {
+				item.Documentation = fmt.Sprintf("#define %s %s", miscToken.Name, miscToken.Value)
+			}
+		}
+	}
+	return item, nil
+}
@@ -4,56 +4,75 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/url"
+	"path"
+	"sort"
 	"strings"
 
 	"github.com/huderlem/poryscript-pls/lsp"
 	"github.com/huderlem/poryscript-pls/parse"
 	"github.com/huderlem/poryscript/ast"
-	"github.com/huderlem/poryscript/lexer"
 	"github.com/huderlem/poryscript/parser"
+	"github.com/huderlem/poryscript/token"
 )
 
 // Checks the given Poryscript file content for diagnostic errors.
 // Any diagnostics are immediately published to the client.
 func (s *poryscriptServer) validatePoryscriptFile(ctx context.Context, fileUri string) error {
-	diagnostics := lsp.PublishDiagnosticsParams{
-		URI:         lsp.DocumentURI(fileUri),
-		Diagnostics: []lsp.Diagnostic{},
+	return s.publishFileDiagnostics(ctx, fileUri, nil)
+}
+
+// Checks the given Poryscript file with the given workspace index, and
+// publishes its diagnostics. If the document changes while it's being
+// checked, the diagnostics are dropped, since the change causes the document
+// to be checked again.
+func (s *poryscriptServer) publishFileDiagnostics(ctx context.Context, fileUri string, workspace *workspaceIndex) error {
+	diagnostics, revision, err := s.getFileDiagnostics(ctx, fileUri, workspace)
+	if revision != 0 && !s.isCurrentRevision(fileUri, revision) {
+		return err
 	}
+	s.connection.Notify(ctx, "textDocument/publishDiagnostics", lsp.PublishDiagnosticsParams{
+		URI:         lsp.DocumentURI(fileUri),
+		Diagnostics: diagnostics,
+	})
+	return err
+}
+
+// Checks the given Poryscript file content for diagnostic errors. Every
+// check sees the same snapshot of the content, whose revision is returned
+// along with the diagnostics. The revision is 0 if the content wasn't read.
+// If the workspace index is nil, it's built once the file has been indexed.
+func (s *poryscriptServer) getFileDiagnostics(ctx context.Context, fileUri string, workspace *workspaceIndex) ([]lsp.Diagnostic, int, error) {
+	diagnostics := []lsp.Diagnostic{}
 	// Only publish diagnostics for Poryscript files.
 	// The language server also has tenuous support for script.inc and text.inc files.
 	if !strings.HasSuffix(fileUri, ".pory") {
-		s.connection.Notify(ctx, "textDocument/publishDiagnostics", diagnostics)
-		return nil
+		return diagnostics, 0, nil
 	}
-	content, err := s.getDocumentContent(ctx, fileUri)
+	uri, _ := url.QueryUnescape(fileUri)
+	doc, err := s.getDocument(ctx, uri)
 	if err != nil {
 		// TODO: log error?
-		s.connection.Notify(ctx, "textDocument/publishDiagnostics", diagnostics)
-		return err
+		return diagnostics, 0, err
+	}
+	index := s.getDocumentFileIndex(ctx, doc, uri)
+	if workspace == nil {
+		workspace = s.newWorkspaceIndex(ctx)
 	}
 
-	// TODO: should this potential error be ignored?
-	commandConfig, _ := s.getAutovarCommands(ctx, fileUri)
-
-	settings, _ := s.config.GetFileSettings(ctx, s.connection, fileUri)
-	fontConfigFilepath := settings.FontConfigFilepath
-
-	p := parser.NewLintParser(lexer.New(content), commandConfig, fontConfigFilepath, "", 0)
-	program, err := p.ParseProgram()
+	program, err := s.getDocumentProgram(ctx, doc, uri)
 	if err == nil {
 		// The poryscript file is syntactically correct. Check for warnings.
-		diagnostics.Diagnostics = append(diagnostics.Diagnostics, s.getPoryscriptWarnings(ctx, program, fileUri)...)
+		diagnostics = append(diagnostics, s.getPoryscriptWarnings(ctx, fileUri, program, parse.Tokenize(doc.content), index, workspace)...)
 	} else {
 		var parsedErr parser.ParseError
 		if !errors.As(err, &parsedErr) {
 			// TODO: this is an unknown error type, so we can't
 			// do anything with it. Log it?
-			s.connection.Notify(ctx, "textDocument/publishDiagnostics", diagnostics)
-			return nil
+			return diagnostics, doc.revision, nil
 		}
 
-		diagnostics.Diagnostics = append(diagnostics.Diagnostics,
+		diagnostics = append(diagnostics,
 			lsp.Diagnostic{
 				Range: lsp.Range{
 					Start: lsp.Position{Line: parsedErr.LineNumberStart - 1, Character: parsedErr.Utf8CharStart},
@@ -65,12 +84,88 @@ func (s *poryscriptServer) validatePoryscriptFile(ctx context.Context, fileUri s
 			},
 		)
 	}
+	diagnostics = append(diagnostics, s.getDuplicateSymbolErrors(index.symbols, workspace)...)
+	return diagnostics, doc.revision, nil
+}
 
-	s.connection.Notify(ctx, "textDocument/publishDiagnostics", diagnostics)
-	return nil
+// Finds the given file symbols that are also defined elsewhere.
+func (s *poryscriptServer) getDuplicateSymbolErrors(fileSymbols []parse.Symbol, workspace *workspaceIndex) []lsp.Diagnostic {
+	diagnostics := []lsp.Diagnostic{}
+	for _, symbol := range fileSymbols {
+		others := []parse.Symbol{}
+		for _, other := range workspace.symbols[symbol.Name] {
+			if other != symbol && symbolsCollide(symbol, other) {
+				others = append(others, other)
+			}
+		}
+		if len(others) == 0 {
+			continue
+		}
+		diagnostic := lsp.Diagnostic{
+			Range:    symbol.ToLocation().Range,
+			Severity: lsp.Error,
+			Source:   "Poryscript",
+			Message:  fmt.Sprintf("Duplicate definition of \"%s\"", symbol.Name),
+			Code:     "error-duplicateSymbol",
+		}
+		if s.config.HasDiagnosticRelatedInfoCapability {
+			for _, other := range others {
+				diagnostic.RelatedInformation = append(diagnostic.RelatedInformation, lsp.DiagnosticRelatedInformation{
+					Location: other.ToLocation(),
+					Message:  fmt.Sprintf("\"%s\" is also defined here", symbol.Name),
+				})
+			}
+		} else {
+			sites := []string{}
+			for _, other := range others {
+				sites = append(sites, fmt.Sprintf("%s:%d", strings.TrimPrefix(other.Uri, "file://"), other.Position.Line+1))
+			}
+			diagnostic.Message += fmt.Sprintf(". It is also defined at %s", strings.Join(sites, ", "))
+		}
+		diagnostics = append(diagnostics, diagnostic)
+	}
+	return diagnostics
 }
 
-func (s *poryscriptServer) getPoryscriptWarnings(ctx context.Context, program *ast.Program, fileUri string) []lsp.Diagnostic {
+// Returns true if the two definitions of the same name conflict. Local
+// labels are only visible in their file, so they only collide with other
+// symbols in the same file. Two local labels only collide when they're in
+// the same script.
+func symbolsCollide(a parse.Symbol, b parse.Symbol) bool {
+	if a.IsFileLocal() && b.IsFileLocal() {
+		return a.Uri == b.Uri && a.Parent == b.Parent
+	}
+	return a.Uri == b.Uri || (!a.IsFileLocal() && !b.IsFileLocal())
+}
+
+// Checks every known Poryscript file in the workspace for diagnostic errors.
+// This is much more expensive than checking a single file, so it only runs
+// when a file is saved. Closed files are skipped if the client wants their
+// diagnostics cleared.
+func (s *poryscriptServer) validateWorkspace(ctx context.Context) {
+	workspace := s.newWorkspaceIndex(ctx)
+	for _, fileUri := range s.getPoryscriptFiles() {
+		if !s.isDocumentOpen(fileUri) {
+			settings, err := s.config.GetFileSettings(ctx, s.connection, fileUri)
+			if err != nil || settings.ClearDiagnosticsOnClose {
+				continue
+			}
+		}
+		s.publishFileDiagnostics(ctx, fileUri, workspace)
+	}
+}
+
+// Clears all of the published diagnostics for the given file.
+func (s *poryscriptServer) clearDiagnostics(ctx context.Context, fileUri string) {
+	s.connection.Notify(ctx, "textDocument/publishDiagnostics", lsp.PublishDiagnosticsParams{
+		URI:         lsp.DocumentURI(fileUri),
+		Diagnostics: []lsp.Diagnostic{},
+	})
+}
+
+// Finds the warnings in a parsed Poryscript file. The program, tokens, and
+// index all come from the same snapshot of the file's content.
+func (s *poryscriptServer) getPoryscriptWarnings(ctx context.Context, fileUri string, program *ast.Program, tokens []token.Token, index fileIndexCacheEntry, workspace *workspaceIndex) []lsp.Diagnostic {
 	diagnostics := []lsp.Diagnostic{}
 	// Convert parser-generated warnings (e.g. line-length validation) to LSP diagnostics.
 	for _, w := range program.Warnings {
@@ -85,19 +180,195 @@ func (s *poryscriptServer) getPoryscriptWarnings(ctx context.Context, program *a
 			Code:     "warning-lineTooLong",
 		})
 	}
+	commands, _ := s.getCommands(ctx, fileUri)
+	isDefined := s.getDefinedNameChecker(ctx, fileUri, commands, index.constants, workspace)
+	tokenIndex := parse.NewTokenIndex(tokens)
 	for _, topStatement := range program.TopLevelStatements {
 		switch statement := topStatement.(type) {
 		case *ast.ScriptStatement:
-			diagnostics = append(diagnostics, s.getScriptWarnings(ctx, fileUri, statement)...)
+			diagnostics = append(diagnostics, getScriptWarnings(statement, commands, tokens, tokenIndex, isDefined)...)
 		case *ast.MovementStatement:
-			diagnostics = append(diagnostics, s.getMovementWarnings(ctx, fileUri, statement)...)
+			diagnostics = append(diagnostics, getMovementWarnings(statement, commands)...)
 		}
 	}
+	diagnostics = append(diagnostics, s.getFlagAndVarWarnings(ctx, fileUri, tokens, index.constants)...)
+	diagnostics = append(diagnostics, s.getUnusedSymbolWarnings(ctx, fileUri, index, workspace)...)
 	return diagnostics
 }
 
+// Finds flags and vars that are used where the other kind is expected, such
+// as 'flag(VAR_TEMP_1)', and names that aren't a known flag or var. This is
+// done with the tokens, rather than the AST, so that the exact argument
+// ranges are known. Unknown names are only reported once the user has
+// explicitly included flags or vars, either with a symbol include of type
+// "flag" or "var", or from flags.h or vars.h. Names that are only
+// categorized by their prefix may come from an incomplete set of includes.
+func (s *poryscriptServer) getFlagAndVarWarnings(ctx context.Context, fileUri string, tokens []token.Token, constants map[string]parse.ConstantSymbol) []lsp.Diagnostic {
+	diagnostics := []lsp.Diagnostic{}
+	miscTokens, _ := s.getMiscTokens(ctx, fileUri)
+	included := map[parse.MiscTokenCategory]bool{}
+	for _, t := range miscTokens {
+		included[t.IncludedCategory()] = true
+	}
+
+	check := func(arg token.Token, expected parse.MiscTokenCategory) {
+		if arg.Type != token.IDENT {
+			return
+		}
+		if _, ok := constants[arg.Literal]; ok {
+			return
+		}
+		var message, code string
+		if t, ok := miscTokens[arg.Literal]; ok {
+			category := t.Category()
+			if category == 0 || category == expected {
+				return
+			}
+			message = fmt.Sprintf("%s is %s, but %s is expected", arg.Literal, withArticle(category.String()), withArticle(expected.String()))
+			code = "warning-wrongFlagOrVar"
+		} else if included[expected] {
+			message = fmt.Sprintf("Unknown %s \"%s\"", expected, arg.Literal)
+			code = "warning-unknownFlagOrVar"
+		} else {
+			return
+		}
+		diagnostics = append(diagnostics, lsp.Diagnostic{
+			Range:    tokenToLSPRange(arg),
+			Severity: lsp.Warning,
+			Source:   "Poryscript",
+			Message:  message,
+			Code:     code,
+		})
+	}
+
+	for i, t := range tokens {
+		switch t.Type {
+		case token.FLAG, token.VAR:
+			// Conditions look like 'flag(FLAG_NAME)' or 'var(VAR_NAME) == 1'.
+			if i+3 >= len(tokens) || tokens[i+1].Type != token.LPAREN || tokens[i+3].Type != token.RPAREN {
+				continue
+			}
+			expected := parse.MiscTokenCategoryFlag
+			if t.Type == token.VAR {
+				expected = parse.MiscTokenCategoryVar
+			}
+			check(tokens[i+2], expected)
+		case token.IDENT:
+			categories, ok := parse.CommandArgCategories[t.Literal]
+			if !ok {
+				continue
+			}
+			for j, arg := range getCommandArgTokens(tokens, i) {
+				if j < len(categories) && len(arg) == 1 {
+					check(arg[0], categories[j])
+				}
+			}
+		}
+	}
+	return diagnostics
+}
+
+// Prefixes the given noun with its indefinite article.
+func withArticle(noun string) string {
+	if len(noun) > 0 && strings.ContainsRune("aeiou", rune(noun[0])) {
+		return "an " + noun
+	}
+	return "a " + noun
+}
+
+// Finds the symbols and constants in the given file that are never referenced
+// anywhere in the workspace. This check is opt-in, because scripts can also be
+// referenced from outside of Poryscript files, such as map JSON files. For the
+// same reason, mapscripts and global labels are never reported. Only the
+// Poryscript files are searched for references, so symbols that are only
+// referenced from assembly files (.inc and .s) must be exempted with the
+// allowlist.
+func (s *poryscriptServer) getUnusedSymbolWarnings(ctx context.Context, fileUri string, fileIndex fileIndexCacheEntry, workspace *workspaceIndex) []lsp.Diagnostic {
+	diagnostics := []lsp.Diagnostic{}
+	settings, err := s.config.GetFileSettings(ctx, s.connection, fileUri)
+	if err != nil || !settings.ReportUnusedSymbols {
+		return diagnostics
+	}
+
+	isExempt := func(name string) bool {
+		for _, pattern := range settings.UnusedSymbolAllowlist {
+			if matched, _ := path.Match(pattern, name); matched {
+				return true
+			}
+		}
+		return false
+	}
+	unusedWarning := func(name string, keyword string, location lsp.Location) lsp.Diagnostic {
+		return lsp.Diagnostic{
+			Range:    location.Range,
+			Severity: lsp.Warning,
+			Source:   "Poryscript",
+			Message:  fmt.Sprintf("Unused %s \"%s\"", keyword, name),
+			Code:     "warning-unusedSymbol",
+			Tags:     []lsp.DiagnosticTag{lsp.Unnecessary},
+		}
+	}
+
+	// Every definition is also a reference to the name, since the reference
+	// index includes the identifier at the definition site. So, a name is
+	// used if it's referenced more times than it's defined.
+	fileReferences := s.getReferenceCounts(ctx, []string{fileUri})
+	for _, symbol := range fileIndex.symbols {
+		isGlobalLabel := symbol.Kind == parse.SymbolKindLabel && symbol.Scope == parse.SymbolScopeGlobal
+		if symbol.Kind == parse.SymbolKindMapScripts || isGlobalLabel || isExempt(symbol.Name) {
+			continue
+		}
+		definitions := 0
+		for _, d := range workspace.symbols[symbol.Name] {
+			if d.Uri == symbol.Uri || (!symbol.IsFileLocal() && !d.IsFileLocal()) {
+				definitions++
+			}
+		}
+		references := fileReferences
+		if !symbol.IsFileLocal() {
+			references = workspace.referenceCounts()
+		}
+		if references[symbol.Name] <= definitions {
+			diagnostics = append(diagnostics, unusedWarning(symbol.Name, symbol.Kind.GetKeyword(), symbol.ToLocation()))
+		}
+	}
+
+	for _, c := range fileIndex.constants {
+		if isExempt(c.Name) {
+			continue
+		}
+		// Constants are local to their file.
+		if fileReferences[c.Name] <= 1 {
+			diagnostics = append(diagnostics, unusedWarning(c.Name, "const", c.ToLocation()))
+		}
+	}
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		a, b := diagnostics[i].Range.Start, diagnostics[j].Range.Start
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Character < b.Character
+	})
+	return diagnostics
+}
+
+// Counts the references to each name in the given files.
+func (s *poryscriptServer) getReferenceCounts(ctx context.Context, files []string) map[string]int {
+	counts := map[string]int{}
+	for _, fileUri := range files {
+		references, err := s.getReferencesInFile(ctx, fileUri)
+		if err != nil {
+			continue
+		}
+		for name, nameReferences := range references {
+			counts[name] += len(nameReferences)
+		}
+	}
+	return counts
+}
+
 // Finds any diagnostic warnings inside a Poryscript script statement.
-func (s *poryscriptServer) getScriptWarnings(ctx context.Context, fileUri string, script *ast.ScriptStatement) []lsp.Diagnostic {
+func getScriptWarnings(script *ast.ScriptStatement, commands map[string]parse.Command, tokens []token.Token, tokenIndex parse.TokenIndex, isDefined func(string) bool) []lsp.Diagnostic {
 	diagnostics := []lsp.Diagnostic{}
 	for _, statement := range script.AllChildren() {
 		cmd, ok := statement.(*ast.CommandStatement)
@@ -105,7 +376,6 @@ func (s *poryscriptServer) getScriptWarnings(ctx context.Context, fileUri string
 			continue
 		}
 		// Check to see if the number of arguments given to the script command is valid.
-		commands, _ := s.getCommands(ctx, fileUri)
 		if command, ok := commands[cmd.Name.Value]; ok && command.Kind == parse.CommandScriptMacro {
 			numRequiredParams := 0
 			for _, p := range command.Parameters {
@@ -135,15 +405,67 @@ func (s *poryscriptServer) getScriptWarnings(ctx context.Context, fileUri string
 						Message:  message,
 					})
 			}
+			argTokens := getCommandArgTokens(tokens, tokenIndex.Find(cmd.Token))
+			diagnostics = append(diagnostics, getUndefinedSymbolWarnings(command, argTokens, isDefined)...)
+		}
+	}
+	return diagnostics
+}
+
+// Finds command arguments that refer to Poryscript symbols which aren't
+// defined anywhere. Only arguments that are a plain identifier are checked,
+// since inline text and movements are defined by the argument itself.
+func getUndefinedSymbolWarnings(command parse.Command, argTokens [][]token.Token, isDefined func(string) bool) []lsp.Diagnostic {
+	diagnostics := []lsp.Diagnostic{}
+	for i, arg := range argTokens {
+		if i >= len(command.Parameters) || len(arg) != 1 || arg[0].Type != token.IDENT {
+			continue
 		}
+		kind := command.Parameters[i].ExpectedSymbolKind()
+		name := arg[0].Literal
+		// All-uppercase names are constants, such as VAR_RESULT or TRUE.
+		if kind == 0 || strings.ToUpper(name) == name || isDefined(name) {
+			continue
+		}
+		diagnostics = append(diagnostics, lsp.Diagnostic{
+			Range:    tokenToLSPRange(arg[0]),
+			Severity: lsp.Warning,
+			Source:   "Poryscript",
+			Message:  fmt.Sprintf("Undefined %s \"%s\"", kind.GetKeyword(), name),
+			Code:     "warning-undefinedSymbol",
+		})
 	}
 	return diagnostics
 }
 
+// Gets a function that reports whether a name is defined as a command,
+// one of the file's constants, an included define, or a Poryscript symbol
+// that is visible from the given file.
+func (s *poryscriptServer) getDefinedNameChecker(ctx context.Context, fileUri string, commands map[string]parse.Command, constants map[string]parse.ConstantSymbol, workspace *workspaceIndex) func(string) bool {
+	uri, _ := url.QueryUnescape(fileUri)
+	miscTokens, _ := s.getMiscTokens(ctx, fileUri)
+	return func(name string) bool {
+		if _, ok := commands[name]; ok {
+			return true
+		}
+		if _, ok := constants[name]; ok {
+			return true
+		}
+		if _, ok := miscTokens[name]; ok {
+			return true
+		}
+		for _, symbol := range workspace.symbols[name] {
+			if isSymbolVisibleFrom(symbol, uri) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
 // Finds any diagnostic warnings inside a Poryscript movement statement.
-func (s *poryscriptServer) getMovementWarnings(ctx context.Context, fileUri string, script *ast.MovementStatement) []lsp.Diagnostic {
+func getMovementWarnings(script *ast.MovementStatement, commands map[string]parse.Command) []lsp.Diagnostic {
 	diagnostics := []lsp.Diagnostic{}
-	commands, _ := s.getCommands(ctx, fileUri)
 	for _, cmd := range script.MovementCommands {
 		if _, ok := commands[cmd.Literal]; !ok {
 			diagnostics = append(diagnostics,
@@ -0,0 +1,361 @@
+package server
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/huderlem/poryscript-pls/config"
+	"github.com/huderlem/poryscript-pls/lsp"
+	"github.com/huderlem/poryscript-pls/parse"
+	"github.com/huderlem/poryscript/ast"
+	"github.com/huderlem/poryscript/token"
+)
+
+// Builds the script statement for the given content, which holds a single
+// script whose body is only commands. The poryscript parser isn't used, so
+// that the test only depends on the tokens.
+func buildTestScript(tokens []token.Token) *ast.ScriptStatement {
+	script := &ast.ScriptStatement{Token: tokens[0], Body: &ast.BlockStatement{}}
+	for i := 3; i < len(tokens); i++ {
+		if tokens[i].Type != token.IDENT || tokens[i-1].Type == token.LPAREN || tokens[i-1].Type == token.COMMA {
+			continue
+		}
+		args := getCommandArgTokens(tokens, i)
+		cmd := &ast.CommandStatement{Token: tokens[i], Name: &ast.Identifier{Token: tokens[i], Value: tokens[i].Literal}}
+		for _, arg := range args {
+			if len(arg) > 0 {
+				cmd.Args = append(cmd.Args, arg[0].Literal)
+			}
+		}
+		script.Body.Statements = append(script.Body.Statements, cmd)
+	}
+	return script
+}
+
+func TestGetScriptWarnings(t *testing.T) {
+	s, root := newTestServer(t, map[string]string{
+		"asm/macros/event.inc": `
+	.macro msgbox text:req, type=MSGBOX_DEFAULT
+	.endm
+	.macro goto destination:req
+	.endm
+	.macro applymovement localId:req, movements:req
+	.endm
+`,
+		"include/strings.h": "#define gText_Included 1\n",
+	})
+	s.config.DefaultSettings.SymbolIncludes = []config.TokenIncludeSetting{
+		{Expression: `^\s*#define\s+(gText_\w+)\s+(.+)`, Type: "define", File: "include/strings.h"},
+	}
+	fileUri := testFileURI(root, "data/scripts/test.pory")
+	ctx := context.Background()
+	commands, _ := s.getCommands(ctx, fileUri)
+	constants := map[string]parse.ConstantSymbol{"MyConst": {Name: "MyConst"}}
+	otherUri := testFileURI(root, "data/scripts/other.pory")
+	workspace := &workspaceIndex{symbols: map[string][]parse.Symbol{
+		"MyLabel":    {{Name: "MyLabel", Kind: parse.SymbolKindLabel, Scope: parse.SymbolScopeLocal, Uri: fileUri}},
+		"MyText":     {{Name: "MyText", Kind: parse.SymbolKindText, Scope: parse.SymbolScopeGlobal, Uri: otherUri}},
+		"OtherLabel": {{Name: "OtherLabel", Kind: parse.SymbolKindLabel, Scope: parse.SymbolScopeLocal, Uri: otherUri}},
+	}}
+	isDefined := s.getDefinedNameChecker(ctx, fileUri, commands, constants, workspace)
+
+	content := `script MyScript {
+	msgbox(MyText)
+	msgbox(MissingText, MSGBOX_DEFAULT)
+	goto(MyLabel)
+	goto(gText_Included)
+	goto(MyConst)
+	goto(msgbox)
+	goto(VAR_RESULT)
+	applymovement(OBJ_EVENT_ID_PLAYER, missing_movement)
+	msgbox("Inline text")
+	goto(MyLabel, MyLabel)
+	goto(OtherLabel)
+}`
+	tokens := parse.Tokenize(content)
+	results := getScriptWarnings(buildTestScript(tokens), commands, tokens, parse.NewTokenIndex(tokens), isDefined)
+	expected := []lsp.Diagnostic{
+		{
+			Range:    lsp.Range{Start: lsp.Position{Line: 2, Character: 8}, End: lsp.Position{Line: 2, Character: 19}},
+			Severity: lsp.Warning,
+			Source:   "Poryscript",
+			Message:  `Undefined text "MissingText"`,
+			Code:     "warning-undefinedSymbol",
+		},
+		{
+			Range:    lsp.Range{Start: lsp.Position{Line: 8, Character: 36}, End: lsp.Position{Line: 8, Character: 52}},
+			Severity: lsp.Warning,
+			Source:   "Poryscript",
+			Message:  `Undefined movement "missing_movement"`,
+			Code:     "warning-undefinedSymbol",
+		},
+		{
+			Range:    lsp.Range{Start: lsp.Position{Line: 10, Character: 1}, End: lsp.Position{Line: 10, Character: 5}},
+			Severity: lsp.Warning,
+			Source:   "Poryscript",
+			Message:  "goto expects a maximum of 1 argument, but 2 were provided",
+		},
+		{
+			Range:    lsp.Range{Start: lsp.Position{Line: 11, Character: 6}, End: lsp.Position{Line: 11, Character: 16}},
+			Severity: lsp.Warning,
+			Source:   "Poryscript",
+			Message:  `Undefined script "OtherLabel"`,
+			Code:     "warning-undefinedSymbol",
+		},
+	}
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("Expected:\n%v\n\nGot:\n%v", expected, results)
+	}
+}
+
+func TestGetUndefinedSymbolWarnings(t *testing.T) {
+	command := parse.Command{
+		Name: "trainerbattle",
+		Parameters: []parse.CommandParam{
+			{Name: "trainer", Kind: parse.CommandParamRequired},
+			{Name: "intro_text", Kind: parse.CommandParamRequired},
+			{Name: "event_script", Kind: parse.CommandParamOptional},
+		},
+	}
+	isDefined := func(name string) bool { return name == "Defined" }
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{input: `trainerbattle(TRAINER_FOO, Defined, Defined)`, expected: []string{}},
+		{input: `trainerbattle(TRAINER_FOO, missing, Missing_Script)`, expected: []string{`Undefined text "missing"`, `Undefined script "Missing_Script"`}},
+		{input: `trainerbattle(undefined_trainer, MISSING_TEXT)`, expected: []string{}},
+		{input: `trainerbattle(TRAINER_FOO, format("Hi"), Defined, extra)`, expected: []string{}},
+		{input: `trainerbattle(TRAINER_FOO, Text + 1)`, expected: []string{}},
+	}
+
+	for i, tt := range tests {
+		tokens := parse.Tokenize(tt.input)
+		results := getUndefinedSymbolWarnings(command, getCommandArgTokens(tokens, 0), isDefined)
+		messages := []string{}
+		for _, d := range results {
+			messages = append(messages, d.Message)
+		}
+		if !reflect.DeepEqual(messages, tt.expected) {
+			t.Errorf("Test Case %d: Expected:\n%v\n\nGot:\n%v", i, tt.expected, messages)
+		}
+	}
+}
+
+// Builds the symbol for the first token with the given name. The poryscript
+// parser isn't used, so that the test only depends on the tokens.
+func buildTestSymbol(tokens []token.Token, uri string, name string, kind parse.SymbolKind, scope parse.SymbolScope) parse.Symbol {
+	for _, t := range tokens {
+		if t.Literal == name {
+			return parse.Symbol{Name: name, Position: lsp.Position{Line: t.LineNumber - 1, Character: t.StartUtf8CharIndex}, Uri: uri, Kind: kind, Scope: scope}
+		}
+	}
+	return parse.Symbol{}
+}
+
+func TestGetUnusedSymbolWarnings(t *testing.T) {
+	fileContent := `mapscripts A_MapScripts {}
+script A_Used {
+	msgbox(A_Text)
+	goto(A_Other)
+}
+script A_Unused {
+A_LocalUsed:
+	goto(A_LocalUsed)
+A_LocalUnused:
+	goto(Shared_Label)
+A_Global::
+}
+text A_Text { "Hi" }
+const USED = 1
+const UNUSED = USED
+script Allowed_Script {}
+`
+	otherContent := `script A_Other {
+Shared_Label:
+	goto(A_Used)
+	goto(A_LocalUnused)
+}
+`
+	s, root := newTestServer(t, map[string]string{
+		"data/scripts/a.pory": fileContent,
+		"data/scripts/b.pory": otherContent,
+	})
+	s.config.DefaultSettings.ReportUnusedSymbols = true
+	s.config.DefaultSettings.UnusedSymbolAllowlist = []string{"Allowed_*"}
+	fileUri := testFileURI(root, "data/scripts/a.pory")
+	otherUri := testFileURI(root, "data/scripts/b.pory")
+	s.addPoryscriptFile(fileUri)
+	s.addPoryscriptFile(otherUri)
+
+	tokens := parse.Tokenize(fileContent)
+	otherTokens := parse.Tokenize(otherContent)
+	fileIndex := fileIndexCacheEntry{
+		symbols: []parse.Symbol{
+			buildTestSymbol(tokens, fileUri, "A_MapScripts", parse.SymbolKindMapScripts, parse.SymbolScopeGlobal),
+			buildTestSymbol(tokens, fileUri, "A_Used", parse.SymbolKindScript, parse.SymbolScopeGlobal),
+			buildTestSymbol(tokens, fileUri, "A_Unused", parse.SymbolKindScript, parse.SymbolScopeGlobal),
+			buildTestSymbol(tokens, fileUri, "A_LocalUsed", parse.SymbolKindLabel, parse.SymbolScopeLocal),
+			buildTestSymbol(tokens, fileUri, "A_LocalUnused", parse.SymbolKindLabel, parse.SymbolScopeLocal),
+			buildTestSymbol(tokens, fileUri, "A_Global", parse.SymbolKindLabel, parse.SymbolScopeGlobal),
+			buildTestSymbol(tokens, fileUri, "A_Text", parse.SymbolKindText, parse.SymbolScopeGlobal),
+			buildTestSymbol(tokens, fileUri, "Allowed_Script", parse.SymbolKindScript, parse.SymbolScopeGlobal),
+		},
+		constants: map[string]parse.ConstantSymbol{
+			"USED":   {Name: "USED", Position: lsp.Position{Line: 13, Character: 6}, Uri: fileUri},
+			"UNUSED": {Name: "UNUSED", Position: lsp.Position{Line: 14, Character: 6}, Uri: fileUri},
+		},
+	}
+	workspace := &workspaceIndex{
+		symbols: map[string][]parse.Symbol{},
+		countReferences: func() map[string]int {
+			return s.getReferenceCounts(context.Background(), s.getPoryscriptFiles())
+		},
+	}
+	otherSymbols := []parse.Symbol{
+		buildTestSymbol(otherTokens, otherUri, "A_Other", parse.SymbolKindScript, parse.SymbolScopeGlobal),
+		buildTestSymbol(otherTokens, otherUri, "Shared_Label", parse.SymbolKindLabel, parse.SymbolScopeLocal),
+	}
+	for _, symbol := range append(fileIndex.symbols, otherSymbols...) {
+		workspace.symbols[symbol.Name] = append(workspace.symbols[symbol.Name], symbol)
+	}
+
+	results := s.getUnusedSymbolWarnings(context.Background(), fileUri, fileIndex, workspace)
+	expected := []lsp.Diagnostic{
+		{
+			Range:    lsp.Range{Start: lsp.Position{Line: 5, Character: 7}, End: lsp.Position{Line: 5, Character: 15}},
+			Severity: lsp.Warning,
+			Source:   "Poryscript",
+			Message:  `Unused script "A_Unused"`,
+			Code:     "warning-unusedSymbol",
+			Tags:     []lsp.DiagnosticTag{lsp.Unnecessary},
+		},
+		{
+			Range:    lsp.Range{Start: lsp.Position{Line: 8, Character: 0}, End: lsp.Position{Line: 8, Character: 13}},
+			Severity: lsp.Warning,
+			Source:   "Poryscript",
+			Message:  `Unused label "A_LocalUnused"`,
+			Code:     "warning-unusedSymbol",
+			Tags:     []lsp.DiagnosticTag{lsp.Unnecessary},
+		},
+		{
+			Range:    lsp.Range{Start: lsp.Position{Line: 14, Character: 6}, End: lsp.Position{Line: 14, Character: 12}},
+			Severity: lsp.Warning,
+			Source:   "Poryscript",
+			Message:  `Unused const "UNUSED"`,
+			Code:     "warning-unusedSymbol",
+			Tags:     []lsp.DiagnosticTag{lsp.Unnecessary},
+		},
+	}
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("Expected:\n%v\n\nGot:\n%v", expected, results)
+	}
+
+	s.config.DefaultSettings.ReportUnusedSymbols = false
+	if results := s.getUnusedSymbolWarnings(context.Background(), fileUri, fileIndex, workspace); len(results) != 0 {
+		t.Errorf("Expected no warnings when unused symbols aren't reported, Got: %v", results)
+	}
+}
+
+func TestGetDuplicateSymbolErrors(t *testing.T) {
+	fileUri := "file:///scripts/a.pory"
+	otherUri := "file:///scripts/b.pory"
+	symbols := []parse.Symbol{
+		{Name: "MyScript", Position: lsp.Position{Line: 0, Character: 7}, Uri: fileUri, Kind: parse.SymbolKindScript, Scope: parse.SymbolScopeGlobal},
+		{Name: "MyLabel", Position: lsp.Position{Line: 1, Character: 0}, Uri: fileUri, Kind: parse.SymbolKindLabel, Scope: parse.SymbolScopeLocal, Parent: "MyScript"},
+		{Name: "MyText", Position: lsp.Position{Line: 3, Character: 5}, Uri: fileUri, Kind: parse.SymbolKindText, Scope: parse.SymbolScopeGlobal},
+	}
+	otherSymbols := []parse.Symbol{
+		{Name: "MyScript", Position: lsp.Position{Line: 4, Character: 7}, Uri: otherUri, Kind: parse.SymbolKindScript, Scope: parse.SymbolScopeGlobal},
+		{Name: "MyLabel", Position: lsp.Position{Line: 5, Character: 0}, Uri: otherUri, Kind: parse.SymbolKindLabel, Scope: parse.SymbolScopeLocal, Parent: "OtherScript"},
+	}
+	workspace := &workspaceIndex{symbols: map[string][]parse.Symbol{}}
+	for _, symbol := range append(symbols, otherSymbols...) {
+		workspace.symbols[symbol.Name] = append(workspace.symbols[symbol.Name], symbol)
+	}
+	scriptRange := lsp.Range{Start: lsp.Position{Line: 0, Character: 7}, End: lsp.Position{Line: 0, Character: 15}}
+	tests := []struct {
+		hasRelatedInfo bool
+		expected       []lsp.Diagnostic
+	}{
+		{
+			hasRelatedInfo: false,
+			expected: []lsp.Diagnostic{
+				{
+					Range:    scriptRange,
+					Severity: lsp.Error,
+					Source:   "Poryscript",
+					Message:  `Duplicate definition of "MyScript". It is also defined at /scripts/b.pory:5`,
+					Code:     "error-duplicateSymbol",
+				},
+			},
+		},
+		{
+			hasRelatedInfo: true,
+			expected: []lsp.Diagnostic{
+				{
+					Range:    scriptRange,
+					Severity: lsp.Error,
+					Source:   "Poryscript",
+					Message:  `Duplicate definition of "MyScript"`,
+					Code:     "error-duplicateSymbol",
+					RelatedInformation: []lsp.DiagnosticRelatedInformation{
+						{Location: otherSymbols[0].ToLocation(), Message: `"MyScript" is also defined here`},
+					},
+				},
+			},
+		},
+	}
+
+	for i, tt := range tests {
+		s := newPoryscriptServer()
+		s.config.HasDiagnosticRelatedInfoCapability = tt.hasRelatedInfo
+		results := s.getDuplicateSymbolErrors(symbols, workspace)
+		if !reflect.DeepEqual(results, tt.expected) {
+			t.Errorf("Test Case %d: Expected:\n%v\n\nGot:\n%v", i, tt.expected, results)
+		}
+	}
+}
+
+func TestGetDuplicateSymbolErrorsInSameFile(t *testing.T) {
+	fileUri := "file:///scripts/a.pory"
+	symbols := []parse.Symbol{
+		{Name: "MyScript", Position: lsp.Position{Line: 0, Character: 7}, Uri: fileUri, Kind: parse.SymbolKindScript, Scope: parse.SymbolScopeGlobal},
+		{Name: "MyLabel", Position: lsp.Position{Line: 1, Character: 0}, Uri: fileUri, Kind: parse.SymbolKindLabel, Scope: parse.SymbolScopeLocal, Parent: "MyScript"},
+		{Name: "OtherScript", Position: lsp.Position{Line: 3, Character: 7}, Uri: fileUri, Kind: parse.SymbolKindScript, Scope: parse.SymbolScopeGlobal},
+		{Name: "MyLabel", Position: lsp.Position{Line: 4, Character: 0}, Uri: fileUri, Kind: parse.SymbolKindLabel, Scope: parse.SymbolScopeLocal, Parent: "OtherScript"},
+	}
+	workspace := &workspaceIndex{symbols: map[string][]parse.Symbol{}}
+	for _, symbol := range symbols {
+		workspace.symbols[symbol.Name] = append(workspace.symbols[symbol.Name], symbol)
+	}
+	if results := newPoryscriptServer().getDuplicateSymbolErrors(symbols, workspace); len(results) != 0 {
+		t.Errorf("Expected no errors for local labels in different scripts, Got: %v", results)
+	}
+
+	// A second label in the same script, and a script with the same name
+	// as a label, are both duplicates.
+	symbols = append(symbols,
+		parse.Symbol{Name: "MyLabel", Position: lsp.Position{Line: 2, Character: 0}, Uri: fileUri, Kind: parse.SymbolKindLabel, Scope: parse.SymbolScopeLocal, Parent: "MyScript"},
+		parse.Symbol{Name: "OtherScript", Position: lsp.Position{Line: 6, Character: 0}, Uri: fileUri, Kind: parse.SymbolKindLabel, Scope: parse.SymbolScopeLocal, Parent: "OtherScript"},
+	)
+	workspace = &workspaceIndex{symbols: map[string][]parse.Symbol{}}
+	for _, symbol := range symbols {
+		workspace.symbols[symbol.Name] = append(workspace.symbols[symbol.Name], symbol)
+	}
+	results := newPoryscriptServer().getDuplicateSymbolErrors(symbols, workspace)
+	messages := []string{}
+	for _, d := range results {
+		messages = append(messages, d.Message)
+	}
+	expected := []string{
+		`Duplicate definition of "MyLabel". It is also defined at /scripts/a.pory:3`,
+		`Duplicate definition of "OtherScript". It is also defined at /scripts/a.pory:7`,
+		`Duplicate definition of "MyLabel". It is also defined at /scripts/a.pory:2`,
+		`Duplicate definition of "OtherScript". It is also defined at /scripts/a.pory:4`,
+	}
+	if !reflect.DeepEqual(messages, expected) {
+		t.Errorf("Expected:\n%v\n\nGot:\n%v", expected, messages)
+	}
+}
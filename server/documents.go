@@ -0,0 +1,143 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+
+	"github.com/huderlem/poryscript-pls/lsp"
+	"github.com/huderlem/poryscript-pls/parse"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// textDocument is a snapshot of a document's content. Documents that are
+// open in the client are owned by the client, and they are kept up-to-date
+// by applying the client's change notifications. Other documents are read
+// from disk.
+type textDocument struct {
+	content string
+	// The LSP version of an open document.
+	version int
+	open    bool
+	// The server's revision of the content. Every new snapshot gets a
+	// higher revision, and the artifacts derived from the content record
+	// the revision they were derived from.
+	revision int
+}
+
+// documentSyncHandler applies document synchronization notifications in the
+// order they are received, before handing every request off to the wrapped
+// handler. The wrapped handler is asynchronous, so the notifications would
+// otherwise race with each other and with the requests that read the
+// documents.
+type documentSyncHandler struct {
+	server  *poryscriptServer
+	handler jsonrpc2.Handler
+}
+
+func (h documentSyncHandler) Handle(ctx context.Context, conn *jsonrpc2.Conn, request *jsonrpc2.Request) {
+	if err := h.server.syncDocument(request); err != nil {
+		os.Stderr.WriteString(err.Error())
+	}
+	h.handler.Handle(ctx, conn, request)
+}
+
+// Updates the document store for the document synchronization notifications.
+// Other requests are ignored. This runs on the connection's read loop, so it
+// must only take the documents mutex, which is never held while waiting on
+// the client. The other caches notice the new revision when they are read.
+func (s *poryscriptServer) syncDocument(request *jsonrpc2.Request) error {
+	if request.Params == nil {
+		return nil
+	}
+	switch request.Method {
+	case "textDocument/didOpen":
+		params := lsp.DidOpenTextDocumentParams{}
+		if err := json.Unmarshal(*request.Params, &params); err != nil {
+			return err
+		}
+		uri, _ := url.QueryUnescape(string(params.TextDocument.URI))
+		s.openDocument(uri, params.TextDocument.Text, params.TextDocument.Version)
+	case "textDocument/didChange":
+		params := lsp.DidChangeTextDocumentParams{}
+		if err := json.Unmarshal(*request.Params, &params); err != nil {
+			return err
+		}
+		uri, _ := url.QueryUnescape(string(params.TextDocument.URI))
+		return s.changeDocument(uri, params.TextDocument.Version, params.ContentChanges)
+	case "textDocument/didClose":
+		params := lsp.DidCloseTextDocumentParams{}
+		if err := json.Unmarshal(*request.Params, &params); err != nil {
+			return err
+		}
+		uri, _ := url.QueryUnescape(string(params.TextDocument.URI))
+		s.closeDocument(uri)
+	}
+	return nil
+}
+
+// Stores the content of a document that was opened in the client.
+func (s *poryscriptServer) openDocument(uri string, content string, version int) {
+	s.documentsMutex.Lock()
+	defer s.documentsMutex.Unlock()
+	s.storeDocument(uri, textDocument{content: content, version: version, open: true})
+}
+
+// Applies the client's content changes to an open document. Changes that
+// are older than the stored version of the document are ignored.
+func (s *poryscriptServer) changeDocument(uri string, version int, changes []lsp.TextDocumentContentChangeEvent) error {
+	s.documentsMutex.Lock()
+	defer s.documentsMutex.Unlock()
+	doc, ok := s.cachedDocuments[uri]
+	if !ok || !doc.open {
+		return fmt.Errorf("received changes for '%s', which is not open", uri)
+	}
+	if version <= doc.version {
+		return nil
+	}
+	content := doc.content
+	for _, change := range changes {
+		var err error
+		if content, err = parse.ApplyContentChange(content, change); err != nil {
+			return fmt.Errorf("failed to apply changes to '%s' version %d: %s", uri, version, err)
+		}
+	}
+	s.storeDocument(uri, textDocument{content: content, version: version, open: true})
+	return nil
+}
+
+// Drops the content of a document that was closed in the client, so that
+// its content is read from disk again.
+func (s *poryscriptServer) closeDocument(uri string) {
+	s.documentsMutex.Lock()
+	defer s.documentsMutex.Unlock()
+	delete(s.cachedDocuments, uri)
+}
+
+// Stores a new snapshot of a document's content with the next revision.
+// The documents mutex must be held by the caller.
+func (s *poryscriptServer) storeDocument(uri string, doc textDocument) textDocument {
+	s.documentRevision++
+	doc.revision = s.documentRevision
+	s.cachedDocuments[uri] = doc
+	return doc
+}
+
+// Returns true if the given revision is the current snapshot of the given
+// document's content.
+func (s *poryscriptServer) isCurrentRevision(uri string, revision int) bool {
+	uri, _ = url.QueryUnescape(uri)
+	s.documentsMutex.Lock()
+	defer s.documentsMutex.Unlock()
+	doc, ok := s.cachedDocuments[uri]
+	return ok && doc.revision == revision
+}
+
+// Returns true if the given document is open in the client.
+func (s *poryscriptServer) isDocumentOpen(uri string) bool {
+	s.documentsMutex.Lock()
+	defer s.documentsMutex.Unlock()
+	return s.cachedDocuments[uri].open
+}
@@ -0,0 +1,241 @@
+package server
+
+import (
+	"context"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/huderlem/poryscript-pls/lsp"
+	"github.com/huderlem/poryscript-pls/parse"
+	"github.com/huderlem/poryscript/ast"
+	"github.com/huderlem/poryscript/token"
+)
+
+// Handles an incoming LSP 'textDocument/documentSymbol' request.
+// https://microsoft.github.io/language-server-protocol/specifications/specification-current/#textDocument_documentSymbol
+func (s *poryscriptServer) onDocumentSymbol(ctx context.Context, req lsp.DocumentSymbolParams) (interface{}, error) {
+	uri, _ := url.QueryUnescape(string(req.TextDocument.URI))
+	doc, err := s.getDocument(ctx, uri)
+	if err != nil {
+		return nil, err
+	}
+	tokens := parse.Tokenize(doc.content)
+
+	var symbols []lsp.DocumentSymbol
+	if program, err := s.getDocumentProgram(ctx, doc, uri); err == nil {
+		symbols = getProgramDocumentSymbols(program, tokens)
+	} else {
+		// The file doesn't parse, so fall back to the flat list of symbol names.
+		symbols = getFallbackDocumentSymbols(doc.content, uri)
+	}
+	index := s.getDocumentFileIndex(ctx, doc, uri)
+	symbols = append(symbols, getConstantDocumentSymbols(index.constants)...)
+	sortDocumentSymbols(symbols)
+
+	if s.config.HasHierarchicalDocumentSymbolCapability {
+		return symbols, nil
+	}
+	return flattenDocumentSymbols(symbols, "", req.TextDocument.URI), nil
+}
+
+// Builds the document outline from the top-level statements of a parsed program.
+func getProgramDocumentSymbols(program *ast.Program, tokens []token.Token) []lsp.DocumentSymbol {
+	symbols := []lsp.DocumentSymbol{}
+	for _, topStatement := range program.TopLevelStatements {
+		switch statement := topStatement.(type) {
+		case *ast.ScriptStatement:
+			symbol, ok := getBlockDocumentSymbol(tokens, statement.Token, statement.Name, parse.SymbolKindScript)
+			if !ok {
+				continue
+			}
+			symbol.Children = getScriptChildDocumentSymbols(statement, tokens)
+			symbols = append(symbols, symbol)
+		case *ast.TextStatement:
+			if symbol, ok := getBlockDocumentSymbol(tokens, statement.Token, statement.Name, parse.SymbolKindText); ok {
+				symbols = append(symbols, symbol)
+			}
+		case *ast.MovementStatement:
+			if symbol, ok := getBlockDocumentSymbol(tokens, statement.Token, statement.Name, parse.SymbolKindMovementScript); ok {
+				symbols = append(symbols, symbol)
+			}
+		case *ast.MartStatement:
+			if symbol, ok := getBlockDocumentSymbol(tokens, statement.Token, statement.Name, parse.SymbolKindMart); ok {
+				symbols = append(symbols, symbol)
+			}
+		case *ast.MapScriptsStatement:
+			if symbol, ok := getBlockDocumentSymbol(tokens, statement.Token, statement.Name, parse.SymbolKindMapScripts); ok {
+				symbols = append(symbols, symbol)
+			}
+		case *ast.RawStatement:
+			start := parse.FindTokenIndex(tokens, statement.Token)
+			if start < 0 || start+1 >= len(tokens) {
+				continue
+			}
+			r := parse.TokenSpanToLSPRange(tokens[start], tokens[start+1])
+			symbols = append(symbols, lsp.DocumentSymbol{
+				Name:           "raw",
+				Kind:           lsp.SKNamespace,
+				Range:          r,
+				SelectionRange: tokenToLSPRange(tokens[start]),
+			})
+		}
+	}
+	return symbols
+}
+
+// Creates the outline entry for a named top-level block, such as a script or text.
+func getBlockDocumentSymbol(tokens []token.Token, keyword token.Token, name *ast.Identifier, kind parse.SymbolKind) (lsp.DocumentSymbol, bool) {
+	if name == nil {
+		return lsp.DocumentSymbol{}, false
+	}
+	start := parse.FindTokenIndex(tokens, keyword)
+	end := parse.FindBlockEnd(tokens, start)
+	if start < 0 || end < 0 {
+		return lsp.DocumentSymbol{}, false
+	}
+	return lsp.DocumentSymbol{
+		Name:           name.Value,
+		Detail:         keyword.Literal,
+		Kind:           kind.GetLSPSymbolKind(),
+		Range:          parse.TokenSpanToLSPRange(tokens[start], tokens[end]),
+		SelectionRange: tokenToLSPRange(name.Token),
+	}, true
+}
+
+// Gets the labels and switch case arms inside of a script.
+func getScriptChildDocumentSymbols(script *ast.ScriptStatement, tokens []token.Token) []lsp.DocumentSymbol {
+	children := []lsp.DocumentSymbol{}
+	for _, statement := range script.AllChildren() {
+		label, ok := statement.(*ast.LabelStatement)
+		if !ok || label.Name == nil {
+			continue
+		}
+		r := tokenToLSPRange(label.Name.Token)
+		children = append(children, lsp.DocumentSymbol{
+			Name:           label.Name.Value,
+			Kind:           parse.SymbolKindLabel.GetLSPSymbolKind(),
+			Range:          r,
+			SelectionRange: r,
+		})
+	}
+
+	start := parse.FindTokenIndex(tokens, script.Token)
+	end := parse.FindBlockEnd(tokens, start)
+	if start >= 0 && end >= 0 {
+		children = append(children, getCaseDocumentSymbols(tokens[start:end+1])...)
+	}
+	sortDocumentSymbols(children)
+	return children
+}
+
+// Gets the case arms of every switch statement in the given tokens. An arm
+// spans from its case keyword to the end of the arm's last statement.
+func getCaseDocumentSymbols(tokens []token.Token) []lsp.DocumentSymbol {
+	symbols := []lsp.DocumentSymbol{}
+	for i, t := range tokens {
+		if t.Type != token.SWITCH {
+			continue
+		}
+		end := parse.FindBlockEnd(tokens, i)
+		if end < 0 {
+			continue
+		}
+		j := i
+		for tokens[j].Type != token.LBRACE {
+			j++
+		}
+		depth := 0
+		armStart := -1
+		addArm := func(armEnd int) {
+			if armStart < 0 || armEnd < armStart {
+				return
+			}
+			nameParts := []string{}
+			selectionEnd := armStart
+			for k := armStart; k <= armEnd && tokens[k].Type != token.COLON; k++ {
+				nameParts = append(nameParts, tokens[k].Literal)
+				selectionEnd = k
+			}
+			symbols = append(symbols, lsp.DocumentSymbol{
+				Name:           strings.Join(nameParts, " "),
+				Kind:           lsp.SKEnumMember,
+				Range:          parse.TokenSpanToLSPRange(tokens[armStart], tokens[armEnd]),
+				SelectionRange: parse.TokenSpanToLSPRange(tokens[armStart], tokens[selectionEnd]),
+			})
+		}
+		for ; j < end; j++ {
+			switch tokens[j].Type {
+			case token.LBRACE:
+				depth++
+			case token.RBRACE:
+				depth--
+			case token.CASE, token.DEFAULT:
+				if depth == 1 {
+					addArm(j - 1)
+					armStart = j
+				}
+			}
+		}
+		addArm(end - 1)
+	}
+	return symbols
+}
+
+// Gets the outline entries for the constants declared in a file.
+func getConstantDocumentSymbols(constants map[string]parse.ConstantSymbol) []lsp.DocumentSymbol {
+	symbols := []lsp.DocumentSymbol{}
+	for _, c := range constants {
+		symbols = append(symbols, lsp.DocumentSymbol{
+			Name:           c.Name,
+			Detail:         "const",
+			Kind:           lsp.SKConstant,
+			Range:          c.Range,
+			SelectionRange: c.ToLocation().Range,
+		})
+	}
+	return symbols
+}
+
+// Builds a flat document outline from the regex-based symbol scan. This
+// is used when the file fails to parse.
+func getFallbackDocumentSymbols(content string, uri string) []lsp.DocumentSymbol {
+	symbols := []lsp.DocumentSymbol{}
+	for _, symbol := range parse.ParseSymbols(content, uri) {
+		r := symbol.ToLocation().Range
+		symbols = append(symbols, lsp.DocumentSymbol{
+			Name:           symbol.Name,
+			Kind:           symbol.Kind.GetLSPSymbolKind(),
+			Range:          r,
+			SelectionRange: r,
+		})
+	}
+	return symbols
+}
+
+// Sorts the document symbols by their starting positions.
+func sortDocumentSymbols(symbols []lsp.DocumentSymbol) {
+	sort.SliceStable(symbols, func(i, j int) bool {
+		a, b := symbols[i].Range.Start, symbols[j].Range.Start
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Character < b.Character
+	})
+}
+
+// Converts a hierarchical document outline into the flat list of symbols
+// for clients that don't support hierarchical document symbols.
+func flattenDocumentSymbols(symbols []lsp.DocumentSymbol, containerName string, uri lsp.DocumentURI) []lsp.SymbolInformation {
+	result := []lsp.SymbolInformation{}
+	for _, symbol := range symbols {
+		result = append(result, lsp.SymbolInformation{
+			Name:          symbol.Name,
+			Kind:          symbol.Kind,
+			Location:      lsp.Location{URI: uri, Range: symbol.Range},
+			ContainerName: containerName,
+		})
+		result = append(result, flattenDocumentSymbols(symbol.Children, symbol.Name, uri)...)
+	}
+	return result
+}
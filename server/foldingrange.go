@@ -0,0 +1,29 @@
+package server
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/huderlem/poryscript-pls/lsp"
+	"github.com/huderlem/poryscript-pls/parse"
+)
+
+// Handles an incoming LSP 'textDocument/foldingRange' request.
+// https://microsoft.github.io/language-server-protocol/specifications/specification-current/#textDocument_foldingRange
+func (s *poryscriptServer) onFoldingRange(ctx context.Context, req lsp.FoldingRangeParams) ([]lsp.FoldingRange, error) {
+	uri, _ := url.QueryUnescape(string(req.TextDocument.URI))
+	doc, err := s.getDocument(ctx, uri)
+	if err != nil {
+		return []lsp.FoldingRange{}, err
+	}
+	program, err := s.getDocumentProgram(ctx, doc, uri)
+	if err != nil {
+		// The file doesn't parse, so fall back to folding the braces.
+		program = nil
+	}
+	ranges := parse.GetFoldingRanges(program, doc.content)
+	if limit := s.config.FoldingRangeLimit; limit > 0 && len(ranges) > limit {
+		ranges = ranges[:limit]
+	}
+	return ranges, nil
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/huderlem/poryscript-pls/lsp"
+	"github.com/huderlem/poryscript-pls/parse"
+)
+
+// Handles an incoming LSP 'textDocument/formatting' request.
+// https://microsoft.github.io/language-server-protocol/specifications/specification-current/#textDocument_formatting
+func (s *poryscriptServer) onFormatting(ctx context.Context, req lsp.DocumentFormattingParams) ([]lsp.TextEdit, error) {
+	uri, _ := url.QueryUnescape(string(req.TextDocument.URI))
+	content, err := s.getDocumentContent(ctx, uri)
+	if err != nil {
+		return []lsp.TextEdit{}, err
+	}
+	formatted := parse.Format(content, req.Options)
+	if formatted == content {
+		return []lsp.TextEdit{}, nil
+	}
+	lines := strings.Split(content, "\n")
+	return []lsp.TextEdit{{
+		Range:   getLinesRange(lines, 0, len(lines)-1),
+		NewText: formatted,
+	}}, nil
+}
+
+// Handles an incoming LSP 'textDocument/rangeFormatting' request. Every
+// line that the range touches is formatted.
+// https://microsoft.github.io/language-server-protocol/specifications/specification-current/#textDocument_rangeFormatting
+func (s *poryscriptServer) onRangeFormatting(ctx context.Context, req lsp.DocumentRangeFormattingParams) ([]lsp.TextEdit, error) {
+	uri, _ := url.QueryUnescape(string(req.TextDocument.URI))
+	content, err := s.getDocumentContent(ctx, uri)
+	if err != nil {
+		return []lsp.TextEdit{}, err
+	}
+	lines := strings.Split(content, "\n")
+	startLine, endLine := req.Range.Start.Line, req.Range.End.Line
+	// A selection of whole lines ends at the start of the next line.
+	if req.Range.End.Character == 0 && endLine > startLine {
+		endLine--
+	}
+	if endLine >= len(lines) {
+		endLine = len(lines) - 1
+	}
+	if startLine < 0 || startLine > endLine {
+		return []lsp.TextEdit{}, nil
+	}
+	r := getLinesRange(lines, startLine, endLine)
+	formatted := parse.FormatLines(content, startLine, endLine, req.Options)
+	original := strings.TrimSuffix(strings.Join(lines[startLine:endLine+1], "\n"), "\r")
+	if formatted == original {
+		return []lsp.TextEdit{}, nil
+	}
+	return []lsp.TextEdit{{Range: r, NewText: formatted}}, nil
+}
+
+// Gets the range that spans from the start of startLine to the end of
+// endLine, not including the line break.
+func getLinesRange(lines []string, startLine int, endLine int) lsp.Range {
+	end := []rune(strings.TrimSuffix(lines[endLine], "\r"))
+	return lsp.Range{
+		Start: lsp.Position{Line: startLine, Character: 0},
+		End:   lsp.Position{Line: endLine, Character: len(utf16.Encode(end))},
+	}
+}
+
+// Handles an incoming LSP 'textDocument/onTypeFormatting' request.
+// https://microsoft.github.io/language-server-protocol/specifications/specification-current/#textDocument_onTypeFormatting
+func (s *poryscriptServer) onTypeFormatting(ctx context.Context, req lsp.DocumentOnTypeFormattingParams) ([]lsp.TextEdit, error) {
+	uri, _ := url.QueryUnescape(string(req.TextDocument.URI))
+	content, err := s.getDocumentContent(ctx, uri)
+	if err != nil {
+		return []lsp.TextEdit{}, err
+	}
+	return parse.FormatOnType(content, req.Position, req.Ch, req.Options), nil
+}
@@ -0,0 +1,205 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/huderlem/poryscript-pls/lsp"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// fileSystem provides access to the files in the workspace. Paths are
+// relative to the workspace root, whereas uris are 'file://' uris.
+type fileSystem interface {
+	// Reads the content of the document with the given uri.
+	ReadDocument(ctx context.Context, uri string) (string, error)
+	// Reads the content of the file at the given path.
+	ReadFile(ctx context.Context, path string) (string, error)
+	// Gets the uri of the file at the given path.
+	FileURI(ctx context.Context, path string) (string, error)
+	// Gets the uris of every Poryscript file in the workspace.
+	PoryscriptFiles(ctx context.Context) ([]string, error)
+}
+
+// diskFileSystem reads the workspace files directly from disk.
+type diskFileSystem struct {
+	// Absolute paths of the workspace folders. Relative paths are
+	// resolved against each root, in order.
+	roots []string
+}
+
+// Creates a diskFileSystem for the workspace folders given by the client.
+func newDiskFileSystem(params lsp.InitializeParams) diskFileSystem {
+	uris := []lsp.DocumentURI{}
+	for _, folder := range params.WorkspaceFolders {
+		uris = append(uris, folder.URI)
+	}
+	if len(uris) == 0 && (params.RootURI != "" || params.RootPath != "") {
+		uris = append(uris, params.Root())
+	}
+	roots := []string{}
+	for _, uri := range uris {
+		root, err := uriToPath(string(uri))
+		if err != nil {
+			os.Stderr.WriteString(err.Error())
+			continue
+		}
+		roots = append(roots, root)
+	}
+	return diskFileSystem{roots: roots}
+}
+
+func (d diskFileSystem) ReadDocument(ctx context.Context, uri string) (string, error) {
+	path, err := uriToPath(uri)
+	if err != nil {
+		return "", err
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
+
+func (d diskFileSystem) ReadFile(ctx context.Context, path string) (string, error) {
+	fullPath, err := d.resolve(path)
+	if err != nil {
+		return "", err
+	}
+	content, err := os.ReadFile(fullPath)
+	if err != nil {
+		return "", err
+	}
+	return string(content), nil
+}
+
+func (d diskFileSystem) FileURI(ctx context.Context, path string) (string, error) {
+	fullPath, err := d.resolve(path)
+	if err != nil {
+		return "", err
+	}
+	return pathToURI(fullPath), nil
+}
+
+func (d diskFileSystem) PoryscriptFiles(ctx context.Context) ([]string, error) {
+	uris := []string{}
+	for _, root := range d.roots {
+		filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				// Skip anything that can't be read, rather than aborting the whole walk.
+				if entry != nil && entry.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if entry.IsDir() {
+				if path != root && strings.HasPrefix(entry.Name(), ".") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if strings.HasSuffix(entry.Name(), ".pory") {
+				uris = append(uris, pathToURI(path))
+			}
+			return nil
+		})
+	}
+	sort.Strings(uris)
+	return uris, nil
+}
+
+// Finds the file with the given path. Relative paths are resolved against
+// the first workspace root that contains the file.
+func (d diskFileSystem) resolve(path string) (string, error) {
+	path = filepath.FromSlash(path)
+	if filepath.IsAbs(path) {
+		return path, nil
+	}
+	for _, root := range d.roots {
+		fullPath := filepath.Join(root, path)
+		if _, err := os.Stat(fullPath); err == nil {
+			return fullPath, nil
+		}
+	}
+	return "", fmt.Errorf("file '%s' does not exist in the workspace", path)
+}
+
+// clientFileSystem reads the workspace files by sending custom requests to
+// the client. This is only supported by the Poryscript VS Code extension.
+type clientFileSystem struct {
+	connection *jsonrpc2.Conn
+	// Whether the client supports workspace folders. The client can't
+	// resolve workspace paths without them.
+	hasWorkspaceFolders bool
+}
+
+func (c clientFileSystem) ReadDocument(ctx context.Context, uri string) (string, error) {
+	var content string
+	if err := c.connection.Call(ctx, "poryscript/readfs", uri, &content); err != nil {
+		return "", err
+	}
+	return content, nil
+}
+
+func (c clientFileSystem) ReadFile(ctx context.Context, path string) (string, error) {
+	if !c.hasWorkspaceFolders {
+		return "", fmt.Errorf("can't read '%s' because the client doesn't support workspace folders", path)
+	}
+	var content string
+	if err := c.connection.Call(ctx, "poryscript/readfile", path, &content); err != nil {
+		return "", err
+	}
+	return content, nil
+}
+
+func (c clientFileSystem) FileURI(ctx context.Context, path string) (string, error) {
+	var fileUri string
+	if err := c.connection.Call(ctx, "poryscript/getfileuri", path, &fileUri); err != nil {
+		return "", err
+	}
+	return fileUri, nil
+}
+
+func (c clientFileSystem) PoryscriptFiles(ctx context.Context) ([]string, error) {
+	var filepaths []string
+	if err := c.connection.Call(ctx, "poryscript/getPoryscriptFiles", nil, &filepaths); err != nil {
+		return nil, err
+	}
+	uris := make([]string, len(filepaths))
+	for i, path := range filepaths {
+		uris[i] = "file://" + path
+	}
+	return uris, nil
+}
+
+// Converts a 'file://' uri into a filesystem path.
+func uriToPath(uri string) (string, error) {
+	if !strings.HasPrefix(uri, "file://") {
+		return "", fmt.Errorf("'%s' is not a file uri", uri)
+	}
+	path := strings.TrimPrefix(uri, "file://")
+	if unescaped, err := url.PathUnescape(path); err == nil {
+		path = unescaped
+	}
+	// Windows paths look like '/C:/foo' in uris.
+	if len(path) >= 3 && path[0] == '/' && path[2] == ':' {
+		path = path[1:]
+	}
+	return filepath.FromSlash(path), nil
+}
+
+// Converts a filesystem path into a 'file://' uri. Like the rest of the
+// server's uris, the result is not escaped.
+func pathToURI(path string) string {
+	path = filepath.ToSlash(path)
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	return "file://" + path
+}
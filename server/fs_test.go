@@ -0,0 +1,239 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/huderlem/poryscript-pls/lsp"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+func TestURIToPath(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{input: "file:///home/user/pokeemerald/data/scripts.pory", expected: "/home/user/pokeemerald/data/scripts.pory"},
+		{input: "file:///home/user/my%20project/a.pory", expected: "/home/user/my project/a.pory"},
+		{input: "file:///home/user/my project/a.pory", expected: "/home/user/my project/a.pory"},
+		{input: "file:///home/user/%C3%A9/%23a.pory", expected: "/home/user/é/#a.pory"},
+		// Invalid escapes are kept as they are.
+		{input: "file:///home/user/100%/a.pory", expected: "/home/user/100%/a.pory"},
+		{input: "file:///C:/Users/user/pokeemerald/a.pory", expected: "C:/Users/user/pokeemerald/a.pory"},
+		{input: "file:///c%3A/Users/user/my%20project/a.pory", expected: "c:/Users/user/my project/a.pory"},
+	}
+
+	for i, tt := range tests {
+		result, err := uriToPath(tt.input)
+		if err != nil {
+			t.Errorf("Test Case %d: Unexpected error: %s", i, err)
+			continue
+		}
+		if expected := filepath.FromSlash(tt.expected); result != expected {
+			t.Errorf("Test Case %d: Expected: %s, Got: %s", i, expected, result)
+		}
+	}
+
+	for _, uri := range []string{"untitled:Untitled-1", "/home/user/a.pory", "http://example.com/a.pory"} {
+		if _, err := uriToPath(uri); err == nil {
+			t.Errorf("Expected an error for %s, which isn't a file uri", uri)
+		}
+	}
+}
+
+func TestPathToURI(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{input: "/home/user/pokeemerald/data/scripts.pory", expected: "file:///home/user/pokeemerald/data/scripts.pory"},
+		// Like the rest of the server's uris, spaces and other characters aren't escaped.
+		{input: "/home/user/my project/é.pory", expected: "file:///home/user/my project/é.pory"},
+		{input: "C:/Users/user/pokeemerald/a.pory", expected: "file:///C:/Users/user/pokeemerald/a.pory"},
+	}
+
+	for i, tt := range tests {
+		result := pathToURI(filepath.FromSlash(tt.input))
+		if result != tt.expected {
+			t.Errorf("Test Case %d: Expected: %s, Got: %s", i, tt.expected, result)
+		}
+		// The uri converts back to the same path.
+		if path, err := uriToPath(result); err != nil || path != filepath.FromSlash(tt.input) {
+			t.Errorf("Test Case %d: Expected the uri to convert back to %s, Got: %s, %v", i, filepath.FromSlash(tt.input), path, err)
+		}
+	}
+}
+
+func TestNewDiskFileSystem(t *testing.T) {
+	tests := []struct {
+		input    lsp.InitializeParams
+		expected []string
+	}{
+		{
+			input: lsp.InitializeParams{
+				RootURI: "file:///home/user/ignored",
+				WorkspaceFolders: []lsp.WorkspaceFolder{
+					{URI: "file:///home/user/pokeemerald"},
+					{URI: "file:///home/user/my%20hack"},
+					{URI: "untitled:skipped"},
+				},
+			},
+			expected: []string{"/home/user/pokeemerald", "/home/user/my hack"},
+		},
+		{input: lsp.InitializeParams{RootURI: "file:///C:/Users/user/pokeemerald"}, expected: []string{"C:/Users/user/pokeemerald"}},
+		{input: lsp.InitializeParams{RootPath: "/home/user/pokeemerald"}, expected: []string{"/home/user/pokeemerald"}},
+		{input: lsp.InitializeParams{}, expected: []string{}},
+	}
+
+	for i, tt := range tests {
+		expected := []string{}
+		for _, root := range tt.expected {
+			expected = append(expected, filepath.FromSlash(root))
+		}
+		if result := newDiskFileSystem(tt.input).roots; !reflect.DeepEqual(result, expected) {
+			t.Errorf("Test Case %d: Expected:\n%v\n\nGot:\n%v", i, expected, result)
+		}
+	}
+}
+
+func TestInitializeFileSystem(t *testing.T) {
+	s := newPoryscriptServer()
+	s.onInitialize(context.Background(), lsp.InitializeParams{RootURI: "file:///home/user/pokeemerald"})
+	if _, ok := s.fs.(diskFileSystem); !ok {
+		t.Errorf("Expected the files to be read from disk by default, Got: %T", s.fs)
+	}
+	s = newPoryscriptServer()
+	s.onInitialize(context.Background(), lsp.InitializeParams{
+		RootURI:               "file:///home/user/pokeemerald",
+		InitializationOptions: map[string]interface{}{"useClientFileSystem": true},
+	})
+	if _, ok := s.fs.(clientFileSystem); !ok {
+		t.Errorf("Expected the files to be read by the client, Got: %T", s.fs)
+	}
+}
+
+func TestDiskFileSystemResolve(t *testing.T) {
+	_, first := newTestServer(t, map[string]string{
+		"include/constants/flags.h": "",
+		"data/first.pory":           "",
+	})
+	_, second := newTestServer(t, map[string]string{
+		"include/constants/flags.h": "",
+		"include/constants/vars.h":  "",
+	})
+	fs := diskFileSystem{roots: []string{first, second}}
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{input: "include/constants/flags.h", expected: filepath.Join(first, "include", "constants", "flags.h")},
+		{input: "include/constants/vars.h", expected: filepath.Join(second, "include", "constants", "vars.h")},
+		// Absolute paths are used as they are, even if they don't exist.
+		{input: filepath.Join(second, "missing.h"), expected: filepath.Join(second, "missing.h")},
+	}
+
+	for i, tt := range tests {
+		result, err := fs.resolve(tt.input)
+		if err != nil {
+			t.Errorf("Test Case %d: Unexpected error: %s", i, err)
+			continue
+		}
+		if result != tt.expected {
+			t.Errorf("Test Case %d: Expected: %s, Got: %s", i, tt.expected, result)
+		}
+	}
+
+	if _, err := fs.resolve("include/constants/missing.h"); err == nil {
+		t.Errorf("Expected an error for a file that isn't in any workspace root")
+	}
+	fileUri, err := fs.FileURI(context.Background(), "data/first.pory")
+	if expected := pathToURI(filepath.Join(first, "data", "first.pory")); err != nil || fileUri != expected {
+		t.Errorf("Expected: %s, Got: %s, %v", expected, fileUri, err)
+	}
+}
+
+func TestDiskFileSystemPoryscriptFiles(t *testing.T) {
+	_, root := newTestServer(t, map[string]string{
+		"data/maps/Route101/scripts.pory": "",
+		"data/maps/Route101/scripts.inc":  "",
+		"data/maps/Route101/map.json":     "",
+		"data/scripts/my scripts.pory":    "",
+		"data/scripts/notes.pory.txt":     "",
+		"data/scripts/.hidden.pory":       "",
+		".git/hooks/hook.pory":            "",
+		"build/.cache/cached.pory":        "",
+	})
+	_, other := newTestServer(t, map[string]string{
+		"other.pory": "",
+	})
+	fs := diskFileSystem{roots: []string{root, other}}
+	results, err := fs.PoryscriptFiles(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		testFileURI(root, "data/maps/Route101/scripts.pory"),
+		testFileURI(root, "data/scripts/.hidden.pory"),
+		testFileURI(root, "data/scripts/my scripts.pory"),
+		testFileURI(other, "other.pory"),
+	}
+	if !reflect.DeepEqual(results, expected) {
+		t.Errorf("Expected:\n%v\n\nGot:\n%v", expected, results)
+	}
+
+	// A root that doesn't exist is skipped.
+	fs = diskFileSystem{roots: []string{filepath.Join(root, "missing"), other}}
+	if results, err := fs.PoryscriptFiles(context.Background()); err != nil || !reflect.DeepEqual(results, []string{testFileURI(other, "other.pory")}) {
+		t.Errorf("Expected only the files in the existing root, Got: %v, %v", results, err)
+	}
+}
+
+func TestClientFileSystem(t *testing.T) {
+	serverSide, clientSide := net.Pipe()
+	ctx := context.Background()
+	connection := jsonrpc2.NewConn(ctx, jsonrpc2.NewBufferedStream(serverSide, jsonrpc2.VSCodeObjectCodec{}), jsonrpc2.HandlerWithError(func(context.Context, *jsonrpc2.Conn, *jsonrpc2.Request) (interface{}, error) {
+		return nil, nil
+	}))
+	client := jsonrpc2.NewConn(ctx, jsonrpc2.NewBufferedStream(clientSide, jsonrpc2.VSCodeObjectCodec{}), jsonrpc2.HandlerWithError(func(ctx context.Context, conn *jsonrpc2.Conn, request *jsonrpc2.Request) (interface{}, error) {
+		var param string
+		if request.Params != nil {
+			json.Unmarshal(*request.Params, &param)
+		}
+		switch request.Method {
+		case "poryscript/getPoryscriptFiles":
+			return []string{"/home/user/my project/a.pory", "/c:/Users/user/b.pory"}, nil
+		case "poryscript/readfs":
+			return "content of " + param, nil
+		case "poryscript/readfile":
+			return "content of " + param, nil
+		}
+		return nil, &jsonrpc2.Error{Code: jsonrpc2.CodeMethodNotFound, Message: request.Method}
+	}))
+	t.Cleanup(func() {
+		client.Close()
+		connection.Close()
+	})
+
+	fs := clientFileSystem{connection: connection, hasWorkspaceFolders: true}
+	uris, err := fs.PoryscriptFiles(ctx)
+	expected := []string{"file:///home/user/my project/a.pory", "file:///c:/Users/user/b.pory"}
+	if err != nil || !reflect.DeepEqual(uris, expected) {
+		t.Errorf("Expected:\n%v\n\nGot:\n%v, %v", expected, uris, err)
+	}
+	if content, err := fs.ReadDocument(ctx, uris[0]); err != nil || content != "content of "+uris[0] {
+		t.Errorf("Expected the client to read %s, Got: %q, %v", uris[0], content, err)
+	}
+	if content, err := fs.ReadFile(ctx, "include/constants/flags.h"); err != nil || content != "content of include/constants/flags.h" {
+		t.Errorf("Expected the client to read the header file, Got: %q, %v", content, err)
+	}
+
+	// Without workspace folders, the client can't resolve workspace paths.
+	fs.hasWorkspaceFolders = false
+	if _, err := fs.ReadFile(ctx, "include/constants/flags.h"); err == nil {
+		t.Errorf("Expected an error when the client doesn't support workspace folders")
+	}
+}
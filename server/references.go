@@ -0,0 +1,169 @@
+package server
+
+import (
+	"context"
+	"net/url"
+	"sort"
+
+	"github.com/huderlem/poryscript-pls/lsp"
+	"github.com/huderlem/poryscript-pls/parse"
+)
+
+// referenceTargetKind is the type of entity that references point to.
+type referenceTargetKind int
+
+const (
+	_ referenceTargetKind = iota
+	referenceTargetSymbol
+	referenceTargetConstant
+	referenceTargetDefine
+)
+
+// referenceTarget describes a named entity whose uses can be found
+// across the workspace's Poryscript files.
+type referenceTarget struct {
+	name string
+	kind referenceTargetKind
+	// The Poryscript files that are searched for uses of the target.
+	files []string
+	// Whether the target is visible from every Poryscript file. A file that
+	// declares a constant or local label with the same name refers to that
+	// instead, so it isn't searched.
+	global bool
+	// Declarations that live inside Poryscript files. These are also
+	// found when scanning the files for references.
+	declarations []lsp.Location
+	// Declarations that live outside of Poryscript files, such as
+	// defines in C header files.
+	externalDeclarations []lsp.Location
+}
+
+// Returns true if the given reference is one of the target's declarations.
+func (t referenceTarget) isDeclaration(r parse.Reference) bool {
+	for _, d := range t.declarations {
+		if string(d.URI) == r.Uri && d.Range.Start == r.Position {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolves the entity with the given name, as seen from the given file uri.
+// Poryscript constants and local labels are local to the file they are
+// declared in, and they take precedence over the symbols and included
+// defines that are visible from every Poryscript file.
+func (s *poryscriptServer) resolveReferenceTarget(ctx context.Context, uri string, name string) (referenceTarget, bool) {
+	constants, _ := s.getConstantsInFile(ctx, uri)
+	if c, ok := constants[name]; ok {
+		return referenceTarget{
+			name:         name,
+			kind:         referenceTargetConstant,
+			files:        []string{uri},
+			declarations: []lsp.Location{c.ToLocation()},
+		}, true
+	}
+
+	definitions := s.getSymbolDefinitions(ctx, uri, name)
+	localTarget := referenceTarget{name: name, kind: referenceTargetSymbol, files: []string{uri}}
+	globalTarget := referenceTarget{name: name, kind: referenceTargetSymbol, files: s.getPoryscriptFiles(), global: true}
+	for _, d := range definitions {
+		if d.IsFileLocal() {
+			localTarget.declarations = append(localTarget.declarations, d.ToLocation())
+		} else {
+			globalTarget.declarations = append(globalTarget.declarations, d.ToLocation())
+		}
+	}
+	if len(localTarget.declarations) > 0 {
+		return localTarget, true
+	}
+	if len(globalTarget.declarations) > 0 {
+		return globalTarget, true
+	}
+
+	miscTokens, _ := s.getMiscTokens(ctx, uri)
+	if t, ok := miscTokens[name]; ok && t.IsDefine() {
+		return referenceTarget{
+			name:                 name,
+			kind:                 referenceTargetDefine,
+			files:                s.getPoryscriptFiles(),
+			global:               true,
+			externalDeclarations: []lsp.Location{t.ToLocation()},
+		}, true
+	}
+
+	return referenceTarget{}, false
+}
+
+// Returns true if the given file declares a constant or local label with the
+// given name, which hides any symbol or define with the same name.
+func (s *poryscriptServer) isNameFileLocal(ctx context.Context, uri string, name string) bool {
+	index, err := s.getFileIndex(ctx, uri)
+	if err != nil {
+		return false
+	}
+	if _, ok := index.constants[name]; ok {
+		return true
+	}
+	for _, symbol := range index.symbols {
+		if symbol.Name == name && symbol.IsFileLocal() {
+			return true
+		}
+	}
+	return false
+}
+
+// Finds every use of the given target in the workspace.
+func (s *poryscriptServer) findReferences(ctx context.Context, target referenceTarget, includeDeclaration bool) []parse.Reference {
+	references := []parse.Reference{}
+	for _, fileUri := range target.files {
+		if target.global && s.isNameFileLocal(ctx, fileUri, target.name) {
+			continue
+		}
+		fileReferences, err := s.getReferencesInFile(ctx, fileUri)
+		if err != nil {
+			// TODO: log error? we don't want to fail if a single file resulted in an error.
+			continue
+		}
+		for _, r := range fileReferences[target.name] {
+			if !includeDeclaration && target.isDeclaration(r) {
+				continue
+			}
+			references = append(references, r)
+		}
+	}
+	return references
+}
+
+// Handles an incoming LSP 'textDocument/references' request.
+// https://microsoft.github.io/language-server-protocol/specifications/specification-current/#textDocument_references
+func (s *poryscriptServer) onReferences(ctx context.Context, req lsp.ReferenceParams) ([]lsp.Location, error) {
+	uri, _ := url.QueryUnescape(string(req.TextDocument.URI))
+	content, err := s.getDocumentContent(ctx, uri)
+	if err != nil {
+		return []lsp.Location{}, err
+	}
+	s.addPoryscriptFile(uri)
+	name := parse.GetTokenAt(content, req.Position.Line, req.Position.Character)
+	target, ok := s.resolveReferenceTarget(ctx, uri, name)
+	if !ok {
+		return []lsp.Location{}, nil
+	}
+
+	locations := []lsp.Location{}
+	if req.Context.IncludeDeclaration {
+		locations = append(locations, target.externalDeclarations...)
+	}
+	for _, r := range s.findReferences(ctx, target, req.Context.IncludeDeclaration) {
+		locations = append(locations, r.ToLocation())
+	}
+	sort.SliceStable(locations, func(i, j int) bool {
+		if locations[i].URI != locations[j].URI {
+			return locations[i].URI < locations[j].URI
+		}
+		if locations[i].Range.Start.Line != locations[j].Range.Start.Line {
+			return locations[i].Range.Start.Line < locations[j].Range.Start.Line
+		}
+		return locations[i].Range.Start.Character < locations[j].Range.Start.Character
+	})
+	return locations, nil
+}
@@ -0,0 +1,154 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/huderlem/poryscript-pls/config"
+	"github.com/huderlem/poryscript-pls/lsp"
+	"github.com/huderlem/poryscript-pls/parse"
+)
+
+// Creates a server for a workspace where the same names are declared with
+// different scopes in each file.
+func newScopeTestServer(t *testing.T) (*poryscriptServer, map[string]string) {
+	s, root := newTestServer(t, map[string]string{
+		"asm/macros/event.inc": `
+	.macro goto destination:req
+	.endm
+`,
+		"include/constants/flags.h": "#define FLAG_FOO 1\n",
+		"data/scripts/a.pory": `const LOCAL_CONST = 1
+script Shared {
+	goto(Label)
+Label:
+	goto(Shared)
+	setflag(LOCAL_CONST)
+}
+`,
+		"data/scripts/b.pory": `const LOCAL_CONST = 2
+script Other {
+Label:
+	goto(Label)
+	goto(Shared)
+	setflag(LOCAL_CONST)
+}
+`,
+		"data/scripts/c.pory": `const Shared = 3
+script Third {
+	setflag(Shared)
+}
+`,
+	})
+	s.config.DefaultSettings.SymbolIncludes = []config.TokenIncludeSetting{
+		{Expression: `^\s*#define\s+(FLAG_\w+)\s+(.+)`, Type: "define", File: "include/constants/flags.h"},
+	}
+	uris := map[string]string{}
+	for _, name := range []string{"a", "b", "c"} {
+		uris[name] = testFileURI(root, "data/scripts/"+name+".pory")
+		s.addPoryscriptFile(uris[name])
+	}
+	setTestSymbols(t, s, uris["a"], []parse.Symbol{
+		{Name: "Shared", Position: lsp.Position{Line: 1, Character: 7}, Uri: uris["a"], Kind: parse.SymbolKindScript, Scope: parse.SymbolScopeGlobal},
+		{Name: "Label", Position: lsp.Position{Line: 3, Character: 0}, Uri: uris["a"], Kind: parse.SymbolKindLabel, Scope: parse.SymbolScopeLocal, Parent: "Shared"},
+	})
+	setTestSymbols(t, s, uris["b"], []parse.Symbol{
+		{Name: "Other", Position: lsp.Position{Line: 1, Character: 7}, Uri: uris["b"], Kind: parse.SymbolKindScript, Scope: parse.SymbolScopeGlobal},
+		{Name: "Label", Position: lsp.Position{Line: 2, Character: 0}, Uri: uris["b"], Kind: parse.SymbolKindLabel, Scope: parse.SymbolScopeLocal, Parent: "Other"},
+	})
+	setTestSymbols(t, s, uris["c"], []parse.Symbol{
+		{Name: "Third", Position: lsp.Position{Line: 1, Character: 7}, Uri: uris["c"], Kind: parse.SymbolKindScript, Scope: parse.SymbolScopeGlobal},
+	})
+	return s, uris
+}
+
+func TestFindReferencesScope(t *testing.T) {
+	s, uris := newScopeTestServer(t)
+	tests := []struct {
+		file     string
+		name     string
+		expected []string
+	}{
+		{file: "a", name: "LOCAL_CONST", expected: []string{"a:0:6", "a:5:9"}},
+		{file: "b", name: "LOCAL_CONST", expected: []string{"b:0:6", "b:5:9"}},
+		{file: "a", name: "Label", expected: []string{"a:2:6", "a:3:0"}},
+		{file: "b", name: "Label", expected: []string{"b:2:0", "b:3:6"}},
+		// The constant in c hides the script.
+		{file: "a", name: "Shared", expected: []string{"a:1:7", "a:4:6", "b:4:6"}},
+		{file: "c", name: "Shared", expected: []string{"c:0:6", "c:2:9"}},
+	}
+
+	ctx := context.Background()
+	for i, tt := range tests {
+		target, ok := s.resolveReferenceTarget(ctx, uris[tt.file], tt.name)
+		if !ok {
+			t.Errorf("Test Case %d: %s wasn't resolved from %s", i, tt.name, tt.file)
+			continue
+		}
+		results := []string{}
+		for _, r := range s.findReferences(ctx, target, true) {
+			file := strings.TrimSuffix(r.Uri[strings.LastIndex(r.Uri, "/")+1:], ".pory")
+			results = append(results, fmt.Sprintf("%s:%d:%d", file, r.Position.Line, r.Position.Character))
+		}
+		sort.Strings(results)
+		if !reflect.DeepEqual(results, tt.expected) {
+			t.Errorf("Test Case %d: Expected:\n%v\n\nGot:\n%v", i, tt.expected, results)
+		}
+	}
+}
+
+func TestRenameNewName(t *testing.T) {
+	s, uris := newScopeTestServer(t)
+	tests := []struct {
+		file          string
+		position      lsp.Position
+		newName       string
+		expectedError string
+		expectedFiles []string
+	}{
+		{file: "a", position: lsp.Position{Line: 3, Character: 1}, newName: "Fresh", expectedFiles: []string{"a"}},
+		{file: "a", position: lsp.Position{Line: 1, Character: 8}, newName: "Fresh", expectedFiles: []string{"a", "b"}},
+		{file: "a", position: lsp.Position{Line: 3, Character: 1}, newName: "1abel", expectedError: "'1abel' is not a valid Poryscript identifier"},
+		{file: "a", position: lsp.Position{Line: 3, Character: 1}, newName: "script", expectedError: "script is a Poryscript keyword"},
+		{file: "a", position: lsp.Position{Line: 3, Character: 1}, newName: "goto", expectedError: "goto is already a command"},
+		{file: "a", position: lsp.Position{Line: 3, Character: 1}, newName: "FLAG_FOO", expectedError: "FLAG_FOO is already defined in an included file"},
+		{file: "a", position: lsp.Position{Line: 3, Character: 1}, newName: "Other", expectedError: "Other is already defined"},
+		{file: "a", position: lsp.Position{Line: 3, Character: 1}, newName: "LOCAL_CONST", expectedError: "LOCAL_CONST is already defined in " + uris["a"]},
+		// The script is used in b, where LOCAL_CONST is also declared.
+		{file: "a", position: lsp.Position{Line: 1, Character: 8}, newName: "LOCAL_CONST", expectedError: "LOCAL_CONST is already defined in " + uris["a"]},
+		// Global symbols are visible from every file, even for a local label.
+		{file: "b", position: lsp.Position{Line: 2, Character: 1}, newName: "Third", expectedError: "Third is already defined"},
+		{file: "b", position: lsp.Position{Line: 1, Character: 8}, newName: "Label", expectedError: "Label is already defined in " + uris["a"]},
+		{file: "c", position: lsp.Position{Line: 2, Character: 10}, newName: "Label", expectedFiles: []string{"c"}},
+	}
+
+	for i, tt := range tests {
+		edit, err := s.onRename(context.Background(), lsp.RenameParams{
+			TextDocument: lsp.TextDocumentIdentifier{URI: lsp.DocumentURI(uris[tt.file])},
+			Position:     tt.position,
+			NewName:      tt.newName,
+		})
+		if tt.expectedError != "" {
+			if err == nil || err.Error() != tt.expectedError {
+				t.Errorf("Test Case %d: Expected error %q, Got: %v", i, tt.expectedError, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Test Case %d: Unexpected error: %s", i, err)
+			continue
+		}
+		files := []string{}
+		for uri := range edit.Changes {
+			files = append(files, strings.TrimSuffix(uri[strings.LastIndex(uri, "/")+1:], ".pory"))
+		}
+		sort.Strings(files)
+		if !reflect.DeepEqual(files, tt.expectedFiles) {
+			t.Errorf("Test Case %d: Expected edits in:\n%v\n\nGot:\n%v", i, tt.expectedFiles, files)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"regexp"
+
+	"github.com/huderlem/poryscript-pls/lsp"
+	"github.com/huderlem/poryscript-pls/parse"
+	"github.com/huderlem/poryscript/token"
+)
+
+var identifierRe = regexp.MustCompile(`^[A-Za-z_]\w*$`)
+
+// Finds the renameable target under the given position. An error is returned
+// if the position is on something that must not be renamed, such as a command
+// macro or a define from an included header file.
+func (s *poryscriptServer) getRenameTarget(ctx context.Context, uri string, position lsp.Position) (referenceTarget, parse.Reference, error) {
+	references, err := s.getReferencesInFile(ctx, uri)
+	if err != nil {
+		return referenceTarget{}, parse.Reference{}, err
+	}
+	content, err := s.getDocumentContent(ctx, uri)
+	if err != nil {
+		return referenceTarget{}, parse.Reference{}, err
+	}
+	name := parse.GetTokenAt(content, position.Line, position.Character)
+	var reference *parse.Reference
+	for _, r := range references[name] {
+		if r.Contains(position) {
+			reference = &r
+			break
+		}
+	}
+	if reference == nil {
+		return referenceTarget{}, parse.Reference{}, fmt.Errorf("there is no symbol to rename at the cursor")
+	}
+
+	target, ok := s.resolveReferenceTarget(ctx, uri, name)
+	if ok && target.kind != referenceTargetDefine {
+		return target, *reference, nil
+	}
+	if ok {
+		return referenceTarget{}, parse.Reference{}, fmt.Errorf("%s is defined in an included file and can't be renamed", name)
+	}
+	commands, _ := s.getCommands(ctx, uri)
+	if _, ok := commands[name]; ok {
+		return referenceTarget{}, parse.Reference{}, fmt.Errorf("%s is a command and can't be renamed", name)
+	}
+	return referenceTarget{}, parse.Reference{}, fmt.Errorf("%s is not a Poryscript symbol", name)
+}
+
+// Checks that the given new name for the target is a valid identifier, and
+// that it doesn't already refer to something in any of the files where the
+// target is used.
+func (s *poryscriptServer) checkRenameName(ctx context.Context, uri string, target referenceTarget, newName string) error {
+	if !identifierRe.MatchString(newName) {
+		return fmt.Errorf("'%s' is not a valid Poryscript identifier", newName)
+	}
+	if token.GetIdentType(newName) != token.IDENT {
+		return fmt.Errorf("%s is a Poryscript keyword", newName)
+	}
+	commands, _ := s.getCommands(ctx, uri)
+	if _, ok := commands[newName]; ok {
+		return fmt.Errorf("%s is already a command", newName)
+	}
+	miscTokens, _ := s.getMiscTokens(ctx, uri)
+	if _, ok := miscTokens[newName]; ok {
+		return fmt.Errorf("%s is already defined in an included file", newName)
+	}
+	for _, d := range s.getSymbolDefinitions(ctx, uri, newName) {
+		if !d.IsFileLocal() {
+			return fmt.Errorf("%s is already defined", newName)
+		}
+	}
+	for _, fileUri := range target.files {
+		if s.isNameFileLocal(ctx, fileUri, newName) {
+			return fmt.Errorf("%s is already defined in %s", newName, fileUri)
+		}
+	}
+	return nil
+}
+
+// Handles an incoming LSP 'textDocument/prepareRename' request.
+// https://microsoft.github.io/language-server-protocol/specifications/specification-current/#textDocument_prepareRename
+func (s *poryscriptServer) onPrepareRename(ctx context.Context, req lsp.PrepareRenameParams) (*lsp.PrepareRenameResult, error) {
+	uri, _ := url.QueryUnescape(string(req.TextDocument.URI))
+	target, reference, err := s.getRenameTarget(ctx, uri, req.Position)
+	if err != nil {
+		return nil, err
+	}
+	return &lsp.PrepareRenameResult{
+		Range:       reference.ToLocation().Range,
+		Placeholder: target.name,
+	}, nil
+}
+
+// Handles an incoming LSP 'textDocument/rename' request.
+// https://microsoft.github.io/language-server-protocol/specifications/specification-current/#textDocument_rename
+func (s *poryscriptServer) onRename(ctx context.Context, req lsp.RenameParams) (*lsp.WorkspaceEdit, error) {
+	uri, _ := url.QueryUnescape(string(req.TextDocument.URI))
+	target, _, err := s.getRenameTarget(ctx, uri, req.Position)
+	if err != nil {
+		return nil, err
+	}
+	if req.NewName == target.name {
+		return &lsp.WorkspaceEdit{Changes: map[string][]lsp.TextEdit{}}, nil
+	}
+	if err := s.checkRenameName(ctx, uri, target, req.NewName); err != nil {
+		return nil, err
+	}
+
+	changes := map[string][]lsp.TextEdit{}
+	for _, r := range s.findReferences(ctx, target, true) {
+		changes[r.Uri] = append(changes[r.Uri], lsp.TextEdit{
+			Range:   r.ToLocation().Range,
+			NewText: req.NewName,
+		})
+	}
+	return &lsp.WorkspaceEdit{Changes: changes}, nil
+}
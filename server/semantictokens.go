@@ -0,0 +1,210 @@
+package server
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+
+	"github.com/huderlem/poryscript-pls/config"
+	"github.com/huderlem/poryscript-pls/lsp"
+	"github.com/huderlem/poryscript-pls/parse"
+	"github.com/huderlem/poryscript/token"
+)
+
+// semanticTokensResult is the most recent set of semantic tokens built for
+// a document. Later delta requests are computed against it, and range
+// requests are sliced from it while the document is unchanged.
+type semanticTokensResult struct {
+	resultID string
+	// The revision of the document content that the tokens were built from.
+	revision int
+	builder  lsp.SemanticTokenBuilder
+	data     []uint
+}
+
+// Handles an incoming LSP 'textDocument/semanticTokens/full' request.
+// https://microsoft.github.io/language-server-protocol/specifications/specification-current/#textDocument_semanticTokens
+func (s *poryscriptServer) onSemanticTokensFull(ctx context.Context, req lsp.SemanticTokensParams) (lsp.SemanticTokens, error) {
+	uri, _ := url.QueryUnescape(string(req.TextDocument.URI))
+	result, err := s.buildSemanticTokens(ctx, uri)
+	if err != nil {
+		return lsp.SemanticTokens{}, err
+	}
+	result, _ = s.storeSemanticTokens(uri, result)
+	return lsp.SemanticTokens{ResultID: result.resultID, Data: result.data}, nil
+}
+
+// Handles an incoming LSP 'textDocument/semanticTokens/full/delta' request.
+// If the client's previous result is no longer cached, the full set of
+// tokens is returned instead of a delta.
+// https://microsoft.github.io/language-server-protocol/specifications/specification-current/#textDocument_semanticTokens
+func (s *poryscriptServer) onSemanticTokensFullDelta(ctx context.Context, req lsp.SemanticTokensDeltaParams) (interface{}, error) {
+	uri, _ := url.QueryUnescape(string(req.TextDocument.URI))
+	result, err := s.buildSemanticTokens(ctx, uri)
+	if err != nil {
+		return lsp.SemanticTokens{}, err
+	}
+	result, previous := s.storeSemanticTokens(uri, result)
+	if previous.resultID != req.PreviousResultID {
+		return lsp.SemanticTokens{ResultID: result.resultID, Data: result.data}, nil
+	}
+	return lsp.SemanticTokensDelta{ResultID: result.resultID, Edits: lsp.DiffSemanticTokens(previous.data, result.data)}, nil
+}
+
+// Handles an incoming LSP 'textDocument/semanticTokens/range' request.
+// The tokens are sliced from the document's cached tokens, unless the
+// document has changed since they were built.
+// https://microsoft.github.io/language-server-protocol/specifications/specification-current/#textDocument_semanticTokens
+func (s *poryscriptServer) onSemanticTokensRange(ctx context.Context, req lsp.SemanticTokensRangeParams) (lsp.SemanticTokens, error) {
+	uri, _ := url.QueryUnescape(string(req.TextDocument.URI))
+	doc, err := s.getDocument(ctx, uri)
+	if err != nil {
+		return lsp.SemanticTokens{}, err
+	}
+	s.semanticTokensMutex.Lock()
+	result, ok := s.cachedSemanticTokens[uri]
+	s.semanticTokensMutex.Unlock()
+	if !ok || result.revision != doc.revision {
+		if result, err = s.buildSemanticTokens(ctx, uri); err != nil {
+			return lsp.SemanticTokens{}, err
+		}
+		result, _ = s.storeSemanticTokens(uri, result)
+	}
+	return lsp.SemanticTokens{Data: result.builder.BuildRange(req.Range)}, nil
+}
+
+// Caches the given semantic tokens for the document with a new result id.
+// Returns the cached result, along with the result that it replaced. The
+// replaced result is looked up in the same critical section, so that
+// concurrent requests each diff against the result they replaced.
+func (s *poryscriptServer) storeSemanticTokens(uri string, result semanticTokensResult) (semanticTokensResult, semanticTokensResult) {
+	s.semanticTokensMutex.Lock()
+	defer s.semanticTokensMutex.Unlock()
+	previous := s.cachedSemanticTokens[uri]
+	s.semanticTokensResults++
+	result.resultID = strconv.Itoa(s.semanticTokensResults)
+	s.cachedSemanticTokens[uri] = result
+	return result, previous
+}
+
+// Clears the cached semantic tokens for the given document.
+func (s *poryscriptServer) clearSemanticTokens(uri string) {
+	s.semanticTokensMutex.Lock()
+	defer s.semanticTokensMutex.Unlock()
+	delete(s.cachedSemanticTokens, uri)
+}
+
+// Builds the semantic tokens for the current content of the given document.
+func (s *poryscriptServer) buildSemanticTokens(ctx context.Context, uri string) (semanticTokensResult, error) {
+	doc, err := s.getDocument(ctx, uri)
+	if err != nil {
+		return semanticTokensResult{}, err
+	}
+	builder := s.getSemanticTokenBuilder(ctx, uri, doc.content)
+	return semanticTokensResult{revision: doc.revision, builder: builder, data: builder.Build()}, nil
+}
+
+// Collects the semantic tokens for every token in the given document content. Each
+// token gets at most one semantic token, since they can't overlap. Only
+// identifiers are looked up by name, in order of precedence: the file's
+// constants, then symbols, then commands, and then miscellaneous tokens. Only the commands from the
+// default command includes are part of the default library.
+func (s *poryscriptServer) getSemanticTokenBuilder(ctx context.Context, uri string, content string) lsp.SemanticTokenBuilder {
+	tokens := parse.Tokenize(content)
+
+	commands, _ := s.getCommands(ctx, uri)
+	constants, _ := s.getConstantsInFile(ctx, uri)
+	miscTokens, _ := s.getMiscTokens(ctx, uri)
+	symbols := s.getAllSymbols(ctx, uri)
+	defaultCommands := s.getDefaultLibraryCommands(ctx, uri)
+
+	builder := lsp.SemanticTokenBuilder{}
+	for _, t := range tokens {
+		add := func(tokenType lsp.SemanticTokenType, modifiers lsp.SemanticTokenModifiers) {
+			builder.AddToken(t.LineNumber-1, t.StartUtf8CharIndex, t.EndUtf8CharIndex-t.StartUtf8CharIndex, tokenType, modifiers)
+		}
+		position := lsp.Position{Line: t.LineNumber - 1, Character: t.StartUtf8CharIndex}
+
+		if t.Type == token.INT {
+			add(lsp.STTNumber, 0)
+		} else if t.Type != token.IDENT {
+			// Strings and keywords, such as 'switch' and 'end', which are
+			// also scripting commands, keep the types that the client gives them.
+			continue
+		} else if constant, ok := constants[t.Literal]; ok {
+			modifiers := lsp.STMReadonly
+			if position == constant.Position {
+				modifiers |= lsp.STMDeclaration
+			}
+			add(lsp.STTEnumMember, modifiers)
+		} else if symbol, ok := symbols[t.Literal]; ok {
+			var modifiers lsp.SemanticTokenModifiers
+			if symbol.Uri == uri && position == symbol.Position {
+				modifiers |= lsp.STMDeclaration
+			}
+			switch symbol.Kind {
+			case parse.SymbolKindScript, parse.SymbolKindMapScripts:
+				add(lsp.STTFunction, modifiers)
+			case parse.SymbolKindLabel:
+				add(lsp.STTLabel, modifiers)
+			case parse.SymbolKindText:
+				add(lsp.STTString, modifiers)
+			case parse.SymbolKindMovementScript, parse.SymbolKindMart:
+				add(lsp.STTVariable, modifiers)
+			}
+		} else if command, ok := commands[t.Literal]; ok {
+			var modifiers lsp.SemanticTokenModifiers
+			if defaultCommands[command.Name] {
+				modifiers |= lsp.STMDefaultLibrary
+			}
+			if command.IsDeprecated() {
+				modifiers |= lsp.STMDeprecated
+			}
+			switch command.Kind {
+			case parse.CommandScriptMacro, parse.CommandMovement:
+				add(lsp.STTMacro, modifiers)
+			case parse.CommandAssemblyConstant:
+				add(lsp.STTEnumMember, modifiers|lsp.STMReadonly)
+			}
+		} else if miscToken, ok := miscTokens[t.Literal]; ok {
+			switch {
+			case miscToken.Type == "special":
+				add(lsp.STTFunction, lsp.STMDefaultLibrary)
+			case miscToken.IsDefine():
+				// Flags and vars are the parameters of the game's script state.
+				switch miscToken.Category() {
+				case parse.MiscTokenCategoryFlag, parse.MiscTokenCategoryVar:
+					add(lsp.STTParameter, lsp.STMReadonly)
+				default:
+					add(lsp.STTEnumMember, lsp.STMReadonly)
+				}
+			default:
+				add(lsp.STTKeyword, 0)
+			}
+		}
+	}
+
+	return builder
+}
+
+// Gets the names of the commands that come from the default command includes,
+// rather than from the includes that the user added. A command that a later
+// include redefines takes that include's origin, like in getCommands.
+func (s *poryscriptServer) getDefaultLibraryCommands(ctx context.Context, uri string) map[string]bool {
+	defaultCommands := map[string]bool{}
+	settings, err := s.config.GetFileSettings(ctx, s.connection, uri)
+	if err != nil {
+		return defaultCommands
+	}
+	for _, includeFilepath := range settings.CommandIncludes {
+		fileCommands, err := s.getCommandsInFile(ctx, includeFilepath)
+		if err != nil {
+			continue
+		}
+		isDefault := config.IsDefaultCommandInclude(includeFilepath)
+		for name := range fileCommands {
+			defaultCommands[name] = isDefault
+		}
+	}
+	return defaultCommands
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/huderlem/poryscript-pls/lsp"
+	"github.com/huderlem/poryscript-pls/parse"
+)
+
+func TestGetSemanticTokenBuilderOnlyResolvesIdentifiers(t *testing.T) {
+	content := `const FOO = 1
+script MyScript {
+	msgbox("FOO msgbox MyScript")
+	switch (var(VAR_RESULT)) {
+		case 1: setvar(FOO, 2)
+	}
+	end
+}
+`
+	s, root := newTestServer(t, map[string]string{
+		"asm/macros/event.inc": `
+	.macro msgbox text:req
+	.endm
+	.macro switch var:req
+	.endm
+	.macro case condition:req, dest:req
+	.endm
+	.macro setvar destination:req, value:req
+	.endm
+	.macro end
+	.endm
+`,
+		"data/scripts/a.pory": content,
+	})
+	uri := testFileURI(root, "data/scripts/a.pory")
+	s.addPoryscriptFile(uri)
+	setTestSymbols(t, s, uri, []parse.Symbol{
+		{Name: "MyScript", Position: lsp.Position{Line: 1, Character: 7}, Uri: uri, Kind: parse.SymbolKindScript, Scope: parse.SymbolScopeGlobal},
+	})
+
+	expected := lsp.SemanticTokenBuilder{}
+	expected.AddToken(0, 6, 3, lsp.STTEnumMember, lsp.STMReadonly|lsp.STMDeclaration)
+	expected.AddToken(0, 12, 1, lsp.STTNumber, 0)
+	expected.AddToken(1, 7, 8, lsp.STTFunction, lsp.STMDeclaration)
+	expected.AddToken(2, 1, 6, lsp.STTMacro, lsp.STMDefaultLibrary)
+	expected.AddToken(4, 7, 1, lsp.STTNumber, 0)
+	expected.AddToken(4, 10, 6, lsp.STTMacro, lsp.STMDefaultLibrary)
+	expected.AddToken(4, 17, 3, lsp.STTEnumMember, lsp.STMReadonly)
+	expected.AddToken(4, 22, 1, lsp.STTNumber, 0)
+	builder := s.getSemanticTokenBuilder(context.Background(), uri, content)
+	if result := builder.Build(); !reflect.DeepEqual(result, expected.Build()) {
+		t.Errorf("Expected:\n%v\n\nGot:\n%v", expected.Build(), result)
+	}
+}
@@ -6,14 +6,13 @@ import (
 	"fmt"
 	"net/url"
 	"os"
+	"strings"
 	"sync"
 
 	"github.com/huderlem/poryscript-pls/config"
 	"github.com/huderlem/poryscript-pls/lsp"
 	"github.com/huderlem/poryscript-pls/parse"
-	"github.com/huderlem/poryscript/lexer"
 	"github.com/huderlem/poryscript/parser"
-	"github.com/huderlem/poryscript/token"
 	"github.com/sourcegraph/jsonrpc2"
 )
 
@@ -22,20 +21,34 @@ type LspServer interface {
 }
 
 func New() LspServer {
-	server := poryscriptServer{
-		config:           config.New(),
-		cachedDocuments:  map[string]string{},
-		cachedCommands:   map[string]map[string]parse.Command{},
-		cachedConstants:  map[string]map[string]parse.ConstantSymbol{},
-		cachedSymbols:    map[string]map[string]parse.Symbol{},
-		cachedMiscTokens: map[string]map[string]parse.MiscToken{},
-	}
+	server := newPoryscriptServer()
 
 	// Wrap with AsyncHandler to allow for calling client requests in the middle of
 	// handling a request. Otherwise, a channel deadlock will occur and cause a panic.
-	handler := jsonrpc2.AsyncHandler(jsonrpc2.HandlerWithError(server.handle))
+	// Document synchronization notifications are applied before that, so that
+	// they take effect in the order they were sent.
+	handler := documentSyncHandler{
+		server:  server,
+		handler: jsonrpc2.AsyncHandler(jsonrpc2.HandlerWithError(server.handle)),
+	}
 	server.connection = jsonrpc2.NewConn(context.Background(), jsonrpc2.NewBufferedStream(StdioRWC{}, jsonrpc2.VSCodeObjectCodec{}), handler)
-	return &server
+	return server
+}
+
+// Creates a poryscriptServer with empty caches and no client connection.
+func newPoryscriptServer() *poryscriptServer {
+	return &poryscriptServer{
+		config:               config.New(),
+		fs:                   diskFileSystem{},
+		cachedDocuments:      map[string]textDocument{},
+		cachedCommands:       map[string]map[string]parse.Command{},
+		cachedIndexes:        map[string]fileIndexCacheEntry{},
+		cachedMiscTokens:     map[miscTokensCacheKey]map[string]parse.MiscToken{},
+		cachedReferences:     map[string]referencesCacheEntry{},
+		cachedPrograms:       map[string]programCacheEntry{},
+		cachedSemanticTokens: map[string]semanticTokensResult{},
+		poryscriptFiles:      map[string]bool{},
+	}
 }
 
 func (server *poryscriptServer) handle(ctx context.Context, conn *jsonrpc2.Conn, request *jsonrpc2.Request) (interface{}, error) {
@@ -54,12 +67,78 @@ func (server *poryscriptServer) handle(ctx context.Context, conn *jsonrpc2.Conn,
 			return nil, err
 		}
 		return server.onCompletion(ctx, params)
+	case "completionItem/resolve":
+		params := lsp.CompletionItem{}
+		if err := json.Unmarshal(*request.Params, &params); err != nil {
+			return nil, err
+		}
+		return server.onCompletionItemResolve(ctx, params)
 	case "textDocument/definition":
 		params := lsp.DefinitionParams{}
 		if err := json.Unmarshal(*request.Params, &params); err != nil {
 			return nil, err
 		}
 		return server.onDefinition(ctx, params)
+	case "textDocument/references":
+		params := lsp.ReferenceParams{}
+		if err := json.Unmarshal(*request.Params, &params); err != nil {
+			return nil, err
+		}
+		return server.onReferences(ctx, params)
+	case "textDocument/prepareRename":
+		params := lsp.PrepareRenameParams{}
+		if err := json.Unmarshal(*request.Params, &params); err != nil {
+			return nil, err
+		}
+		return server.onPrepareRename(ctx, params)
+	case "textDocument/rename":
+		params := lsp.RenameParams{}
+		if err := json.Unmarshal(*request.Params, &params); err != nil {
+			return nil, err
+		}
+		return server.onRename(ctx, params)
+	case "textDocument/documentSymbol":
+		params := lsp.DocumentSymbolParams{}
+		if err := json.Unmarshal(*request.Params, &params); err != nil {
+			return nil, err
+		}
+		return server.onDocumentSymbol(ctx, params)
+	case "textDocument/formatting":
+		params := lsp.DocumentFormattingParams{}
+		if err := json.Unmarshal(*request.Params, &params); err != nil {
+			return nil, err
+		}
+		return server.onFormatting(ctx, params)
+	case "textDocument/rangeFormatting":
+		params := lsp.DocumentRangeFormattingParams{}
+		if err := json.Unmarshal(*request.Params, &params); err != nil {
+			return nil, err
+		}
+		return server.onRangeFormatting(ctx, params)
+	case "textDocument/onTypeFormatting":
+		params := lsp.DocumentOnTypeFormattingParams{}
+		if err := json.Unmarshal(*request.Params, &params); err != nil {
+			return nil, err
+		}
+		return server.onTypeFormatting(ctx, params)
+	case "textDocument/foldingRange":
+		params := lsp.FoldingRangeParams{}
+		if err := json.Unmarshal(*request.Params, &params); err != nil {
+			return nil, err
+		}
+		return server.onFoldingRange(ctx, params)
+	case "workspace/symbol":
+		params := lsp.WorkspaceSymbolParams{}
+		if err := json.Unmarshal(*request.Params, &params); err != nil {
+			return nil, err
+		}
+		return server.onWorkspaceSymbol(ctx, params)
+	case "textDocument/hover":
+		params := lsp.HoverParams{}
+		if err := json.Unmarshal(*request.Params, &params); err != nil {
+			return nil, err
+		}
+		return server.onHover(ctx, params)
 	case "textDocument/signatureHelp":
 		params := lsp.SignatureHelpParams{}
 		if err := json.Unmarshal(*request.Params, &params); err != nil {
@@ -72,6 +151,18 @@ func (server *poryscriptServer) handle(ctx context.Context, conn *jsonrpc2.Conn,
 			return nil, err
 		}
 		return server.onSemanticTokensFull(ctx, params)
+	case "textDocument/semanticTokens/full/delta":
+		params := lsp.SemanticTokensDeltaParams{}
+		if err := json.Unmarshal(*request.Params, &params); err != nil {
+			return nil, err
+		}
+		return server.onSemanticTokensFullDelta(ctx, params)
+	case "textDocument/semanticTokens/range":
+		params := lsp.SemanticTokensRangeParams{}
+		if err := json.Unmarshal(*request.Params, &params); err != nil {
+			return nil, err
+		}
+		return server.onSemanticTokensRange(ctx, params)
 	case "textDocument/codeAction":
 		params := lsp.CodeActionParams{}
 		if err := json.Unmarshal(*request.Params, &params); err != nil {
@@ -96,6 +187,18 @@ func (server *poryscriptServer) handle(ctx context.Context, conn *jsonrpc2.Conn,
 			return nil, err
 		}
 		return nil, server.onTextDocumentDidChange(ctx, params)
+	case "textDocument/didClose":
+		params := lsp.DidCloseTextDocumentParams{}
+		if err := json.Unmarshal(*request.Params, &params); err != nil {
+			return nil, err
+		}
+		return nil, server.onTextDocumentDidClose(ctx, params)
+	case "textDocument/didSave":
+		params := lsp.DidSaveTextDocumentParams{}
+		if err := json.Unmarshal(*request.Params, &params); err != nil {
+			return nil, err
+		}
+		return nil, server.onTextDocumentDidSave(ctx, params)
 	case "workspace/didChangeConfiguration":
 		params := lsp.DidChangeConfigurationParams{}
 		if err := json.Unmarshal(*request.Params, &params); err != nil {
@@ -118,18 +221,27 @@ func (server *poryscriptServer) handle(ctx context.Context, conn *jsonrpc2.Conn,
 type poryscriptServer struct {
 	connection            *jsonrpc2.Conn
 	config                config.Config
-	cachedDocuments       map[string]string
+	fs                    fileSystem
+	cachedDocuments       map[string]textDocument
 	cachedCommands        map[string]map[string]parse.Command
-	cachedConstants       map[string]map[string]parse.ConstantSymbol
-	cachedSymbols         map[string]map[string]parse.Symbol
-	cachedMiscTokens      map[string]map[string]parse.MiscToken
+	cachedIndexes         map[string]fileIndexCacheEntry
+	cachedMiscTokens      map[miscTokensCacheKey]map[string]parse.MiscToken
 	cachedAutovarCommands map[string]parser.CommandConfig
+	cachedReferences      map[string]referencesCacheEntry
+	poryscriptFiles       map[string]bool
+	cachedPrograms        map[string]programCacheEntry
+	cachedSemanticTokens  map[string]semanticTokensResult
+	semanticTokensResults int
+	documentRevision      int
 	documentsMutex        sync.Mutex
 	commandsMutex         sync.Mutex
-	constantsMutex        sync.Mutex
-	symbolsMutex          sync.Mutex
+	indexesMutex          sync.Mutex
 	miscTokensMutex       sync.Mutex
 	commandConfigMutex    sync.Mutex
+	referencesMutex       sync.Mutex
+	poryscriptFilesMutex  sync.Mutex
+	programsMutex         sync.Mutex
+	semanticTokensMutex   sync.Mutex
 }
 
 // Runs the LSP server indefinitely.
@@ -142,27 +254,58 @@ func (s *poryscriptServer) Run() {
 func (s *poryscriptServer) onInitialize(ctx context.Context, params lsp.InitializeParams) *lsp.InitializeResult {
 	s.config.HasConfigCapability = params.Capabilities.Workspace.Configuration
 	s.config.HasWorkspaceFolderCapability = params.Capabilities.Workspace.WorkspaceFolders
+	s.config.HasDiagnosticRelatedInfoCapability = params.Capabilities.TextDocument.PublishDiagnostics.RelatedInformation
+	s.config.HasHierarchicalDocumentSymbolCapability = params.Capabilities.TextDocument.DocumentSymbol.HierarchicalDocumentSymbolSupport
+	s.config.HasSnippetCapability = params.Capabilities.TextDocument.Completion.CompletionItem.SnippetSupport
+	if foldingRange := params.Capabilities.TextDocument.FoldingRange; foldingRange != nil {
+		if limit, ok := foldingRange.RangeLimit.(float64); ok {
+			s.config.FoldingRangeLimit = int(limit)
+		}
+	}
+	if config.ParseInitializationOptions(params.InitializationOptions).UseClientFileSystem {
+		s.fs = clientFileSystem{
+			connection:          s.connection,
+			hasWorkspaceFolders: s.config.HasWorkspaceFolderCapability,
+		}
+	} else {
+		s.fs = newDiskFileSystem(params)
+	}
 
 	return &lsp.InitializeResult{
 		Capabilities: lsp.ServerCapabilities{
 			TextDocumentSync: &lsp.TextDocumentSyncOptionsOrKind{
 				Options: &lsp.TextDocumentSyncOptions{
 					OpenClose: true,
-					Change:    lsp.TDSKFull,
+					Change:    lsp.TDSKIncremental,
+					Save:      &lsp.SaveOptions{},
 				},
 			},
-			CompletionProvider: &lsp.CompletionOptions{},
+			HoverProvider: true,
+			CompletionProvider: &lsp.CompletionOptions{
+				ResolveProvider: true,
+			},
 			SignatureHelpProvider: &lsp.SignatureHelpOptions{
 				TriggerCharacters: []string{"(", ","},
 			},
 			SemanticTokensProvider: &lsp.SemanticTokensOptions{
-				Full:  lsp.STPFFull,
-				Range: false,
-				Legend: lsp.SemanticTokensLegend{
-					TokenTypes: []string{"keyword", "function", "enumMember", "variable"},
-				},
+				Full:   lsp.STPFFullDelta,
+				Range:  true,
+				Legend: lsp.NewSemanticTokensLegend(),
+			},
+			DefinitionProvider:              true,
+			DocumentSymbolProvider:          true,
+			FoldingRangeProvider:            true,
+			DocumentFormattingProvider:      true,
+			DocumentRangeFormattingProvider: true,
+			DocumentOnTypeFormattingProvider: &lsp.DocumentOnTypeFormattingOptions{
+				FirstTriggerCharacter: "}",
+				MoreTriggerCharacter:  []string{":", "\n"},
+			},
+			WorkspaceSymbolProvider: true,
+			ReferencesProvider:      true,
+			RenameProvider: &lsp.RenameOptions{
+				PrepareProvider: true,
 			},
-			DefinitionProvider: true,
 			CodeActionProvider: &lsp.CodeActionOptions{
 				ResolveProvider: true,
 			},
@@ -197,51 +340,19 @@ func (s *poryscriptServer) onInitialized(ctx context.Context) error {
 		var result interface{}
 		s.connection.Call(ctx, "client/registerCapability", params, &result)
 	}
-	var filepaths []string
-	if err := s.connection.Call(ctx, "poryscript/getPoryscriptFiles", nil, &filepaths); err != nil {
+	fileUris, err := s.fs.PoryscriptFiles(ctx)
+	if err != nil {
 		os.Stderr.WriteString(err.Error())
 	}
-	for _, filepath := range filepaths {
-		if _, err := s.getSymbolsInFile(ctx, "file://"+filepath); err != nil {
+	for _, fileUri := range fileUris {
+		s.addPoryscriptFile(fileUri)
+		if _, err := s.getSymbolsInFile(ctx, fileUri); err != nil {
 			os.Stderr.WriteString(err.Error())
 		}
 	}
 	return nil
 }
 
-// Handles an incoming LSP 'textDocument/completion' request.
-// https://microsoft.github.io/language-server-protocol/specifications/specification-current/#textDocument_completion
-func (s *poryscriptServer) onCompletion(ctx context.Context, req lsp.CompletionParams) ([]lsp.CompletionItem, error) {
-	commands, _ := s.getCommands(ctx, string(req.TextDocument.URI))
-	constants, _ := s.getConstantsInFile(ctx, string(req.TextDocument.URI))
-	miscTokens, _ := s.getMiscTokens(ctx, string(req.TextDocument.URI))
-
-	s.getSymbolsInFile(ctx, string(req.TextDocument.URI))
-	symbols := []parse.Symbol{}
-	s.symbolsMutex.Lock()
-	for _, fileSymbols := range s.cachedSymbols {
-		for _, s := range fileSymbols {
-			symbols = append(symbols, s)
-		}
-	}
-	s.symbolsMutex.Unlock()
-
-	completionItems := []lsp.CompletionItem{}
-	for _, command := range commands {
-		completionItems = append(completionItems, command.ToCompletionItem())
-	}
-	for _, constant := range constants {
-		completionItems = append(completionItems, constant.ToCompletionItem())
-	}
-	for _, symbol := range symbols {
-		completionItems = append(completionItems, symbol.ToCompletionItem())
-	}
-	for _, miscToken := range miscTokens {
-		completionItems = append(completionItems, miscToken.ToCompletionItem())
-	}
-	return completionItems, nil
-}
-
 // Handles an incoming LSP 'textDocument/definition' request.
 // https://microsoft.github.io/language-server-protocol/specifications/specification-current/#textDocument_definition
 func (s *poryscriptServer) onDefinition(ctx context.Context, req lsp.DefinitionParams) ([]lsp.Location, error) {
@@ -256,34 +367,67 @@ func (s *poryscriptServer) onDefinition(ctx context.Context, req lsp.DefinitionP
 		return []lsp.Location{c.ToLocation()}, nil
 	}
 
-	s.getSymbolsInFile(ctx, string(req.TextDocument.URI))
-	symbols := map[string]parse.Symbol{}
-	s.symbolsMutex.Lock()
-	for _, fileSymbols := range s.cachedSymbols {
-		for _, s := range fileSymbols {
-			symbols[s.Name] = s
+	if definitions := s.getSymbolDefinitions(ctx, string(req.TextDocument.URI), token); len(definitions) > 0 {
+		locations := []lsp.Location{}
+		for _, d := range definitions {
+			locations = append(locations, d.ToLocation())
 		}
+		return locations, nil
 	}
-	s.symbolsMutex.Unlock()
 
+	miscTokens, _ := s.getMiscTokens(ctx, string(req.TextDocument.URI))
+	if t, ok := miscTokens[token]; ok {
+		return []lsp.Location{t.ToLocation()}, nil
+	}
+
+	return []lsp.Location{}, nil
+}
+
+// Handles an incoming LSP 'textDocument/hover' request.
+// https://microsoft.github.io/language-server-protocol/specifications/specification-current/#textDocument_hover
+func (s *poryscriptServer) onHover(ctx context.Context, req lsp.HoverParams) (*lsp.Hover, error) {
+	content, err := s.getDocumentContent(ctx, string(req.TextDocument.URI))
+	if err != nil {
+		return nil, err
+	}
+	token := parse.GetTokenAt(content, req.Position.Line, req.Position.Character)
+	if len(token) == 0 {
+		return nil, nil
+	}
+
+	commands, _ := s.getCommands(ctx, string(req.TextDocument.URI))
+	if c, ok := commands[token]; ok {
+		hover := c.ToHover()
+		return &hover, nil
+	}
+
+	constants, _ := s.getConstantsInFile(ctx, string(req.TextDocument.URI))
+	if c, ok := constants[token]; ok {
+		hover := c.ToHover()
+		return &hover, nil
+	}
+
+	symbols := s.getAllSymbols(ctx, string(req.TextDocument.URI))
 	if s, ok := symbols[token]; ok {
-		return []lsp.Location{s.ToLocation()}, nil
+		hover := s.ToHover()
+		return &hover, nil
 	}
 
 	miscTokens, _ := s.getMiscTokens(ctx, string(req.TextDocument.URI))
 	if t, ok := miscTokens[token]; ok {
-		return []lsp.Location{t.ToLocation()}, nil
+		hover := t.ToHover()
+		return &hover, nil
 	}
 
-	return []lsp.Location{}, nil
+	return nil, nil
 }
 
 // Handles an incoming LSP 'textDocument/signatureHelp' request.
 // https://microsoft.github.io/language-server-protocol/specifications/specification-current/#textDocument_signatureHelp
 func (s *poryscriptServer) onSignatureHelp(ctx context.Context, req lsp.SignatureHelpParams) (lsp.SignatureHelp, error) {
 	uri, _ := url.QueryUnescape(string(req.TextDocument.URI))
-	var content string
-	if err := s.connection.Call(ctx, "poryscript/readfs", uri, &content); err != nil {
+	content, err := s.getDocumentContent(ctx, uri)
+	if err != nil {
 		return lsp.SignatureHelp{}, err
 	}
 
@@ -299,14 +443,8 @@ func (s *poryscriptServer) onSignatureHelp(ctx context.Context, req lsp.Signatur
 	if !ok || len(command.Parameters) == 0 {
 		return lsp.SignatureHelp{}, nil
 	}
-	if req.Position.Character < callInfo.OpenParen.Character+1 || req.Position.Character > callInfo.CloseParen.Character {
-		return lsp.SignatureHelp{}, nil
-	}
 
-	paramId := 0
-	for paramId < len(callInfo.Commas) && req.Position.Character > callInfo.Commas[paramId].Character {
-		paramId++
-	}
+	paramId := callInfo.GetArgIndex(req.Position)
 	if paramId >= len(command.Parameters) && command.HasVarargParam() {
 		paramId = len(command.Parameters) - 1
 	}
@@ -328,9 +466,11 @@ func (s *poryscriptServer) onSignatureHelp(ctx context.Context, req lsp.Signatur
 // https://microsoft.github.io/language-server-protocol/specifications/specification-current/#textDocument_didOpen
 func (s *poryscriptServer) onTextDocumentDidOpen(ctx context.Context, req lsp.DidOpenTextDocumentParams) error {
 	fileUri, _ := url.QueryUnescape(string(req.TextDocument.URI))
-	_, err := s.getDocumentContent(ctx, fileUri)
+	if strings.HasSuffix(fileUri, ".pory") {
+		s.addPoryscriptFile(fileUri)
+	}
 	s.validatePoryscriptFile(ctx, fileUri)
-	return err
+	return nil
 }
 
 // Handles an incoming LSP 'textDocument/didChange' request.
@@ -339,12 +479,43 @@ func (s *poryscriptServer) onTextDocumentDidChange(ctx context.Context, req lsp.
 	if len(req.ContentChanges) == 0 {
 		return nil
 	}
+	// The changes were already applied to the document store by the
+	// documentSyncHandler.
 	fileUri, _ := url.QueryUnescape(string(req.TextDocument.URI))
-	s.clearCaches(fileUri)
 	s.validatePoryscriptFile(ctx, fileUri)
 	return nil
 }
 
+// Handles an incoming LSP 'textDocument/didClose' request.
+// https://microsoft.github.io/language-server-protocol/specifications/specification-current/#textDocument_didClose
+func (s *poryscriptServer) onTextDocumentDidClose(ctx context.Context, req lsp.DidCloseTextDocumentParams) error {
+	// The document was already dropped from the document store by the
+	// documentSyncHandler, so it now falls back to the on-disk version.
+	fileUri, _ := url.QueryUnescape(string(req.TextDocument.URI))
+	s.clearSemanticTokens(fileUri)
+	settings, err := s.config.GetFileSettings(ctx, s.connection, fileUri)
+	if err != nil {
+		return err
+	}
+	if settings.ClearDiagnosticsOnClose {
+		s.clearDiagnostics(ctx, fileUri)
+		return nil
+	}
+	return s.validatePoryscriptFile(ctx, fileUri)
+}
+
+// Handles an incoming LSP 'textDocument/didSave' request.
+// https://microsoft.github.io/language-server-protocol/specifications/specification-current/#textDocument_didSave
+func (s *poryscriptServer) onTextDocumentDidSave(ctx context.Context, req lsp.DidSaveTextDocumentParams) error {
+	fileUri, _ := url.QueryUnescape(string(req.TextDocument.URI))
+	if strings.HasSuffix(fileUri, ".pory") {
+		s.addPoryscriptFile(fileUri)
+	}
+	s.clearCaches(fileUri)
+	s.validateWorkspace(ctx)
+	return nil
+}
+
 // Handles an incoming LSP 'workspace/didChangeConfiguration' request.
 // https://microsoft.github.io/language-server-protocol/specifications/specification-current/#workspace_didChangeConfiguration
 func (s *poryscriptServer) onDidChangeConfiguration(ctx context.Context, req lsp.DidChangeConfigurationParams) error {
@@ -360,81 +531,3 @@ func (s *poryscriptServer) onDidChangeWatchedFiles(ctx context.Context, req lsp.
 	s.clearWatchedFileCaches()
 	return nil
 }
-
-// Handles an incoming LSP 'textDocument/semanticTokens/full' request.
-// https://microsoft.github.io/language-server-protocol/specifications/specification-current/#textDocument_semanticTokens
-func (s *poryscriptServer) onSemanticTokensFull(ctx context.Context, req lsp.SemanticTokensParams) (lsp.SemanticTokens, error) {
-	uri, _ := url.QueryUnescape(string(req.TextDocument.URI))
-	var content string
-	if err := s.connection.Call(ctx, "poryscript/readfs", uri, &content); err != nil {
-		return lsp.SemanticTokens{}, err
-	}
-
-	// Collect the tokens.
-	l := lexer.New(content)
-	tokens := []token.Token{}
-	for {
-		t := l.NextToken()
-		if t.Type == token.EOF {
-			break
-		}
-		tokens = append(tokens, t)
-	}
-
-	commands, _ := s.getCommands(ctx, string(req.TextDocument.URI))
-	constants, _ := s.getConstantsInFile(ctx, string(req.TextDocument.URI))
-	miscTokens, _ := s.getMiscTokens(ctx, string(req.TextDocument.URI))
-	s.getSymbolsInFile(ctx, string(req.TextDocument.URI))
-	symbols := map[string]parse.Symbol{}
-	s.symbolsMutex.Lock()
-	for _, fileSymbols := range s.cachedSymbols {
-		for _, s := range fileSymbols {
-			symbols[s.Name] = s
-		}
-	}
-	s.symbolsMutex.Unlock()
-
-	// TODO: use strongly-typed token types for AddToken(), rather than hardcoded integers
-	builder := lsp.SemanticTokenBuilder{}
-	for _, t := range tokens {
-		if command, ok := commands[t.Literal]; ok {
-			// 'switch' and 'case' are both Poryscript keywords and scripting commands.
-			if t.Literal != "switch" && t.Literal != "case" {
-				switch command.CompletionKind {
-				case lsp.CIKFunction:
-					builder.AddToken(t.LineNumber-1, t.StartUtf8CharIndex, t.EndUtf8CharIndex-t.StartUtf8CharIndex, 1, 0)
-				case lsp.CIKConstant:
-					builder.AddToken(t.LineNumber-1, t.StartUtf8CharIndex, t.EndUtf8CharIndex-t.StartUtf8CharIndex, 0, 0)
-				}
-			}
-		}
-
-		if constant, ok := constants[t.Literal]; ok {
-			if t.LineNumber-1 != constant.Position.Line {
-				builder.AddToken(t.LineNumber-1, t.StartUtf8CharIndex, t.EndUtf8CharIndex-t.StartUtf8CharIndex, 2, 0)
-			}
-		}
-
-		if symbol, ok := symbols[t.Literal]; ok {
-			switch symbol.Kind {
-			case parse.SymbolKindScript, parse.SymbolKindMapScripts:
-				builder.AddToken(t.LineNumber-1, t.StartUtf8CharIndex, t.EndUtf8CharIndex-t.StartUtf8CharIndex, 1, 0)
-			case parse.SymbolKindMovementScript, parse.SymbolKindMart, parse.SymbolKindText, parse.SymbolKindLabel:
-				builder.AddToken(t.LineNumber-1, t.StartUtf8CharIndex, t.EndUtf8CharIndex-t.StartUtf8CharIndex, 3, 0)
-			}
-		}
-
-		if miscToken, ok := miscTokens[t.Literal]; ok {
-			switch miscToken.Type {
-			case "special":
-				builder.AddToken(t.LineNumber-1, t.StartUtf8CharIndex, t.EndUtf8CharIndex-t.StartUtf8CharIndex, 1, 0)
-			case "define":
-				builder.AddToken(t.LineNumber-1, t.StartUtf8CharIndex, t.EndUtf8CharIndex-t.StartUtf8CharIndex, 2, 0)
-			default:
-				builder.AddToken(t.LineNumber-1, t.StartUtf8CharIndex, t.EndUtf8CharIndex-t.StartUtf8CharIndex, 0, 0)
-			}
-		}
-	}
-
-	return lsp.SemanticTokens{Data: builder.Build()}, nil
-}
@@ -0,0 +1,241 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/huderlem/poryscript-pls/config"
+	"github.com/huderlem/poryscript-pls/lsp"
+	"github.com/huderlem/poryscript-pls/parse"
+	"github.com/sourcegraph/jsonrpc2"
+)
+
+// Writes the given files to a temporary workspace, and creates a server
+// that reads them from disk, the same way the check command does. Returns
+// the server and the workspace root.
+func newTestServer(t *testing.T, files map[string]string) (*poryscriptServer, string) {
+	root := t.TempDir()
+	for path, content := range files {
+		path = filepath.Join(root, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := newPoryscriptServer()
+	s.config.DefaultSettings.CommandConfigFilepath = ""
+	s.config.DefaultSettings.FontConfigFilepath = ""
+	s.fs = diskFileSystem{roots: []string{root}}
+	return s, root
+}
+
+// Gets the uri of the file at the given path in a test workspace.
+func testFileURI(root string, path string) string {
+	return pathToURI(filepath.Join(root, filepath.FromSlash(path)))
+}
+
+// Replaces the indexed symbols for the given file, since the poryscript
+// parser isn't used to index them in tests. The file's constants are still
+// indexed from its content.
+func setTestSymbols(t *testing.T, s *poryscriptServer, uri string, symbols []parse.Symbol) {
+	index, err := s.getFileIndex(context.Background(), uri)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index.symbols = symbols
+	s.indexesMutex.Lock()
+	s.cachedIndexes[uri] = index
+	s.indexesMutex.Unlock()
+}
+
+// testClient records the diagnostics that a server publishes to it.
+type testClient struct {
+	server     *poryscriptServer
+	mutex      sync.Mutex
+	published  []lsp.PublishDiagnosticsParams
+	connection *jsonrpc2.Conn
+}
+
+// Connects a client to the given server, which records the diagnostics that
+// the server publishes.
+func connectTestClient(t *testing.T, s *poryscriptServer) *testClient {
+	serverSide, clientSide := net.Pipe()
+	client := &testClient{server: s}
+	ctx := context.Background()
+	s.connection = jsonrpc2.NewConn(ctx, jsonrpc2.NewBufferedStream(serverSide, jsonrpc2.VSCodeObjectCodec{}), jsonrpc2.HandlerWithError(func(context.Context, *jsonrpc2.Conn, *jsonrpc2.Request) (interface{}, error) {
+		return nil, nil
+	}))
+	client.connection = jsonrpc2.NewConn(ctx, jsonrpc2.NewBufferedStream(clientSide, jsonrpc2.VSCodeObjectCodec{}), jsonrpc2.HandlerWithError(client.handle))
+	t.Cleanup(func() {
+		client.connection.Close()
+		s.connection.Close()
+	})
+	return client
+}
+
+func (c *testClient) handle(ctx context.Context, conn *jsonrpc2.Conn, request *jsonrpc2.Request) (interface{}, error) {
+	if request.Method == "textDocument/publishDiagnostics" && request.Params != nil {
+		params := lsp.PublishDiagnosticsParams{}
+		if err := json.Unmarshal(*request.Params, &params); err != nil {
+			return nil, err
+		}
+		c.mutex.Lock()
+		c.published = append(c.published, params)
+		c.mutex.Unlock()
+	}
+	return nil, nil
+}
+
+// Gets the diagnostics that were published since the last call, keyed by
+// file uri. The client handles messages in order, so a round trip from the
+// server ensures that every earlier notification has been recorded.
+func (c *testClient) takePublished(t *testing.T) map[string][]lsp.Diagnostic {
+	if err := c.server.connection.Call(context.Background(), "test/sync", nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	published := map[string][]lsp.Diagnostic{}
+	for _, p := range c.published {
+		published[string(p.URI)] = p.Diagnostics
+	}
+	c.published = nil
+	return published
+}
+
+// Creates a server for a workspace with flag and var defines, so that
+// diagnostics can be produced without the poryscript parser.
+func newFlagTestServer(t *testing.T, files map[string]string) (*poryscriptServer, string) {
+	files["include/constants/flags.h"] = "#define FLAG_FOO 0x1\n"
+	files["include/constants/vars.h"] = "#define VAR_FOO 0x4000\n"
+	s, root := newTestServer(t, files)
+	s.config.DefaultSettings.SymbolIncludes = []config.TokenIncludeSetting{
+		{Expression: `^\s*#define\s+(FLAG_\w+)\s+(.+)`, Type: "define", File: "include/constants/flags.h"},
+		{Expression: `^\s*#define\s+(VAR_\w+)\s+(.+)`, Type: "define", File: "include/constants/vars.h"},
+	}
+	return s, root
+}
+
+// Gets the codes of the given diagnostics.
+func diagnosticCodes(diagnostics []lsp.Diagnostic) []string {
+	codes := []string{}
+	for _, d := range diagnostics {
+		codes = append(codes, d.Code)
+	}
+	return codes
+}
+
+func TestTextDocumentDidClose(t *testing.T) {
+	for _, clearOnClose := range []bool{false, true} {
+		s, root := newFlagTestServer(t, map[string]string{
+			"data/scripts/a.pory": "script A {\n\tif (flag(FLAG_FOO)) {\n\t}\n}\n",
+		})
+		s.config.DefaultSettings.ClearDiagnosticsOnClose = clearOnClose
+		client := connectTestClient(t, s)
+		ctx := context.Background()
+		uri := testFileURI(root, "data/scripts/a.pory")
+
+		s.openDocument(uri, "script A {\n\tif (flag(VAR_FOO)) {\n\t}\n}\n", 1)
+		s.onTextDocumentDidOpen(ctx, lsp.DidOpenTextDocumentParams{TextDocument: lsp.TextDocumentItem{URI: lsp.DocumentURI(uri)}})
+		if codes := diagnosticCodes(client.takePublished(t)[uri]); !reflect.DeepEqual(codes, []string{"warning-wrongFlagOrVar"}) {
+			t.Errorf("ClearDiagnosticsOnClose=%v: Expected a warning for the open document, Got: %v", clearOnClose, codes)
+		}
+		if _, err := s.onSemanticTokensFull(ctx, lsp.SemanticTokensParams{TextDocument: lsp.TextDocumentIdentifier{URI: lsp.DocumentURI(uri)}}); err != nil {
+			t.Fatal(err)
+		}
+
+		s.closeDocument(uri)
+		if err := s.onTextDocumentDidClose(ctx, lsp.DidCloseTextDocumentParams{TextDocument: lsp.TextDocumentIdentifier{URI: lsp.DocumentURI(uri)}}); err != nil {
+			t.Fatal(err)
+		}
+		// The document reverts to the clean content on disk, either way.
+		published, ok := client.takePublished(t)[uri]
+		if !ok || len(published) != 0 {
+			t.Errorf("ClearDiagnosticsOnClose=%v: Expected empty diagnostics after closing, Got: %v", clearOnClose, published)
+		}
+		if content, _ := s.getDocumentContent(ctx, uri); !strings.Contains(content, "FLAG_FOO") {
+			t.Errorf("ClearDiagnosticsOnClose=%v: Expected the content on disk after closing, Got: %q", clearOnClose, content)
+		}
+		if s.isDocumentOpen(uri) {
+			t.Errorf("ClearDiagnosticsOnClose=%v: Expected the document to be closed", clearOnClose)
+		}
+		s.semanticTokensMutex.Lock()
+		_, ok = s.cachedSemanticTokens[uri]
+		s.semanticTokensMutex.Unlock()
+		if ok {
+			t.Errorf("ClearDiagnosticsOnClose=%v: Expected the semantic tokens to be cleared after closing", clearOnClose)
+		}
+	}
+}
+
+func TestTextDocumentDidSave(t *testing.T) {
+	for _, clearOnClose := range []bool{false, true} {
+		s, root := newFlagTestServer(t, map[string]string{
+			"data/scripts/a.pory": "script A {\n}\n",
+			"data/scripts/b.pory": "script B {\n\tif (flag(VAR_FOO)) {\n\t}\n}\n",
+		})
+		s.config.DefaultSettings.ClearDiagnosticsOnClose = clearOnClose
+		client := connectTestClient(t, s)
+		ctx := context.Background()
+		uriA := testFileURI(root, "data/scripts/a.pory")
+		uriB := testFileURI(root, "data/scripts/b.pory")
+		s.addPoryscriptFile(uriA)
+		s.addPoryscriptFile(uriB)
+		s.openDocument(uriA, "script A {\n}\n", 1)
+		// Cache b's content before it changes on disk.
+		s.getDocumentContent(ctx, uriB)
+
+		content := "script A {\n\tif (flag(FLAG_MISSING)) {\n\t}\n}\n"
+		if err := os.WriteFile(filepath.Join(root, "data", "scripts", "a.pory"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		s.changeDocument(uriA, 2, []lsp.TextDocumentContentChangeEvent{{Text: content}})
+		client.takePublished(t)
+		if err := s.onTextDocumentDidSave(ctx, lsp.DidSaveTextDocumentParams{TextDocument: lsp.TextDocumentIdentifier{URI: lsp.DocumentURI(uriA)}}); err != nil {
+			t.Fatal(err)
+		}
+		published := client.takePublished(t)
+		if codes := diagnosticCodes(published[uriA]); !reflect.DeepEqual(codes, []string{"warning-unknownFlagOrVar"}) {
+			t.Errorf("ClearDiagnosticsOnClose=%v: Expected a warning for the saved document, Got: %v", clearOnClose, codes)
+		}
+		// The rest of the workspace is checked, unless closed files' diagnostics are cleared.
+		codes, ok := published[uriB]
+		if clearOnClose && ok {
+			t.Errorf("ClearDiagnosticsOnClose=%v: Expected no diagnostics for the closed file, Got: %v", clearOnClose, codes)
+		} else if !clearOnClose && !reflect.DeepEqual(diagnosticCodes(codes), []string{"warning-wrongFlagOrVar"}) {
+			t.Errorf("ClearDiagnosticsOnClose=%v: Expected a warning for the closed file, Got: %v", clearOnClose, diagnosticCodes(codes))
+		}
+	}
+}
+
+func TestTextDocumentDidSaveReadsDisk(t *testing.T) {
+	s, root := newFlagTestServer(t, map[string]string{
+		"data/scripts/a.pory": "script A {\n}\n",
+	})
+	client := connectTestClient(t, s)
+	ctx := context.Background()
+	uri := testFileURI(root, "data/scripts/a.pory")
+	s.addPoryscriptFile(uri)
+	s.getDocumentContent(ctx, uri)
+
+	// The file isn't open, so it was saved by something other than the client.
+	content := "script A {\n\tif (flag(VAR_FOO)) {\n\t}\n}\n"
+	if err := os.WriteFile(filepath.Join(root, "data", "scripts", "a.pory"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.onTextDocumentDidSave(ctx, lsp.DidSaveTextDocumentParams{TextDocument: lsp.TextDocumentIdentifier{URI: lsp.DocumentURI(uri)}}); err != nil {
+		t.Fatal(err)
+	}
+	if codes := diagnosticCodes(client.takePublished(t)[uri]); !reflect.DeepEqual(codes, []string{"warning-wrongFlagOrVar"}) {
+		t.Errorf("Expected a warning for the new content on disk, Got: %v", codes)
+	}
+}
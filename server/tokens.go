@@ -0,0 +1,47 @@
+package server
+
+import (
+	"github.com/huderlem/poryscript/token"
+)
+
+// Gets the arguments of the command call whose name is the token at the
+// given index. Each argument is the list of tokens between the call's
+// top-level commas. Returns nil if the command isn't followed by a
+// parenthesized argument list.
+func getCommandArgTokens(tokens []token.Token, nameIndex int) [][]token.Token {
+	if nameIndex < 0 || nameIndex+1 >= len(tokens) || tokens[nameIndex+1].Type != token.LPAREN {
+		return nil
+	}
+	args := [][]token.Token{}
+	arg := []token.Token{}
+	depth := 0
+	for i := nameIndex + 1; i < len(tokens); i++ {
+		t := tokens[i]
+		switch t.Type {
+		case token.LPAREN:
+			depth++
+			if depth == 1 {
+				continue
+			}
+		case token.RPAREN:
+			depth--
+			if depth == 0 {
+				if len(arg) > 0 || len(args) > 0 {
+					args = append(args, arg)
+				}
+				return args
+			}
+		case token.COMMA:
+			if depth == 1 {
+				args = append(args, arg)
+				arg = []token.Token{}
+				continue
+			}
+		case token.LBRACE, token.RBRACE:
+			// The call was never closed.
+			return nil
+		}
+		arg = append(arg, t)
+	}
+	return nil
+}
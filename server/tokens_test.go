@@ -0,0 +1,45 @@
+package server
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/huderlem/poryscript-pls/parse"
+)
+
+func TestGetCommandArgTokens(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected [][]string
+	}{
+		{input: `msgbox(MyText, MSGBOX_DEFAULT)`, expected: [][]string{{"MyText"}, {"MSGBOX_DEFAULT"}}},
+		{input: `goto()`, expected: [][]string{}},
+		{input: `setvar(VAR_RESULT, (FOO + 1) * 2)`, expected: [][]string{{"VAR_RESULT"}, {"(", "FOO", "+", "1", ")", "*", "2"}}},
+		{input: `msgbox(, MSGBOX_DEFAULT)`, expected: [][]string{{}, {"MSGBOX_DEFAULT"}}},
+		{input: `msgbox(format(MyText))`, expected: [][]string{{"format", "(", "MyText", ")"}}},
+		{input: `waitstate`, expected: nil},
+		{input: `msgbox(MyText }`, expected: nil},
+	}
+
+	for i, tt := range tests {
+		argTokens := getCommandArgTokens(parse.Tokenize(tt.input), 0)
+		var result [][]string
+		if argTokens != nil {
+			result = [][]string{}
+			for _, arg := range argTokens {
+				literals := []string{}
+				for _, t := range arg {
+					literals = append(literals, t.Literal)
+				}
+				result = append(result, literals)
+			}
+		}
+		if !reflect.DeepEqual(result, tt.expected) {
+			t.Errorf("Test Case %d: Expected:\n%v\n\nGot:\n%v", i, tt.expected, result)
+		}
+	}
+
+	if getCommandArgTokens(parse.Tokenize(`msgbox(MyText)`), -1) != nil {
+		t.Errorf("Expected no arguments for a command that wasn't found")
+	}
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"context"
+	"sort"
+
+	"github.com/huderlem/poryscript-pls/lsp"
+	"github.com/huderlem/poryscript-pls/parse"
+)
+
+// The maximum number of results returned from a workspace symbol search.
+const maxWorkspaceSymbols = 200
+
+// Handles an incoming LSP 'workspace/symbol' request.
+// https://microsoft.github.io/language-server-protocol/specifications/specification-current/#workspace_symbol
+func (s *poryscriptServer) onWorkspaceSymbol(ctx context.Context, req lsp.WorkspaceSymbolParams) ([]lsp.SymbolInformation, error) {
+	for _, uri := range s.getPoryscriptFiles() {
+		s.getSymbolsInFile(ctx, uri)
+	}
+
+	type match struct {
+		symbol parse.Symbol
+		score  int
+	}
+	matches := []match{}
+	for _, fileSymbols := range s.getCachedSymbols(ctx) {
+		for _, symbol := range fileSymbols {
+			if score, ok := parse.FuzzyMatch(req.Query, symbol.Name); ok {
+				matches = append(matches, match{symbol: symbol, score: score})
+			}
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		if a.score != b.score {
+			return a.score > b.score
+		}
+		if len(a.symbol.Name) != len(b.symbol.Name) {
+			return len(a.symbol.Name) < len(b.symbol.Name)
+		}
+		if a.symbol.Name != b.symbol.Name {
+			return a.symbol.Name < b.symbol.Name
+		}
+		return a.symbol.Uri < b.symbol.Uri
+	})
+
+	limit := maxWorkspaceSymbols
+	if req.Limit > 0 && req.Limit < limit {
+		limit = req.Limit
+	}
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+	symbols := make([]lsp.SymbolInformation, len(matches))
+	for i, m := range matches {
+		symbols[i] = m.symbol.ToSymbolInformation()
+	}
+	return symbols, nil
+}